@@ -3,6 +3,7 @@ module mcpchromem
 go 1.24.3
 
 require (
+	github.com/google/jsonschema-go v0.3.0
 	github.com/google/uuid v1.6.0
 	github.com/modelcontextprotocol/go-sdk v1.0.0
 	github.com/philippgille/chromem-go v0.7.0
@@ -10,7 +11,6 @@ require (
 )
 
 require (
-	github.com/google/jsonschema-go v0.3.0 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.19 // indirect
 	github.com/yosida95/uritemplate/v3 v3.0.2 // indirect
@@ -0,0 +1,272 @@
+package internal
+
+import "net/http"
+
+// explorerPath serves the interactive API explorer.
+const explorerPath = "/api/explorer"
+
+// explorerHTML renders /api/openapi.json and lets users send requests with
+// their dashboard session. It is self-contained because the Content Security
+// Policy only allows the page's own script.
+const explorerHTML = `
+<!DOCTYPE html>
+<html>
+<head>
+    <title>Memory Server - API Explorer</title>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <style>
+        body { font-family: Arial, sans-serif; margin: 20px; background-color: #f5f5f5; }
+        .container { max-width: 1200px; margin: 0 auto; background: white; padding: 20px; border-radius: 8px; box-shadow: 0 2px 4px rgba(0,0,0,0.1); }
+        .header { border-bottom: 2px solid #007bff; padding-bottom: 10px; margin-bottom: 20px; }
+        .header a { margin-right: 15px; }
+        h2 { color: #333; border-bottom: 1px solid #ddd; padding-bottom: 5px; }
+        details.operation { border: 1px solid #ddd; border-radius: 5px; margin-bottom: 10px; background: #f9f9f9; }
+        details.operation > summary { padding: 10px; cursor: pointer; }
+        .operation-body { padding: 0 15px 15px; }
+        .method { display: inline-block; min-width: 60px; font-weight: bold; font-family: monospace; color: white; padding: 2px 6px; border-radius: 3px; text-align: center; margin-right: 10px; }
+        .method-get { background: #007bff; }
+        .method-post { background: #28a745; }
+        .method-put { background: #fd7e14; }
+        .method-delete { background: #dc3545; }
+        .path { font-family: monospace; font-weight: bold; margin-right: 10px; }
+        .params { border-collapse: collapse; margin: 10px 0; width: 100%; }
+        .params td { padding: 4px 8px; vertical-align: top; }
+        .params input { width: 100%; padding: 6px; border: 1px solid #ddd; border-radius: 4px; box-sizing: border-box; }
+        .required { color: #dc3545; }
+        textarea { width: 100%; height: 140px; font-family: monospace; padding: 8px; border: 1px solid #ddd; border-radius: 4px; box-sizing: border-box; }
+        pre { background: #272822; color: #f8f8f2; padding: 10px; border-radius: 4px; overflow-x: auto; max-height: 400px; }
+        .btn { background: #007bff; color: white; padding: 8px 16px; border: none; border-radius: 4px; cursor: pointer; margin: 10px 0; }
+        .status { font-weight: bold; }
+        .status-ok { color: #28a745; }
+        .status-error { color: #dc3545; }
+        .muted { color: #666; font-size: 12px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>API Explorer</h1>
+            <a href="/">Dashboard</a>
+            <a href="/api/openapi.json">openapi.json</a>
+            <span class="muted" id="api-info"></span>
+        </div>
+        <div id="operations">Loading...</div>
+    </div>
+
+    <script nonce="{{.Nonce}}">
+        let spec = null;
+
+        function el(tag, className, text) {
+            const node = document.createElement(tag);
+            if (className) {
+                node.className = className;
+            }
+            if (text !== undefined) {
+                node.textContent = text;
+            }
+            return node;
+        }
+
+        // resolve follows a local $ref into the spec's components.
+        function resolve(schema) {
+            if (schema && schema.$ref) {
+                const name = schema.$ref.split('/').pop();
+                return spec.components.schemas[name];
+            }
+            return schema;
+        }
+
+        function schemaName(schema) {
+            if (!schema) {
+                return '';
+            }
+            if (schema.$ref) {
+                return schema.$ref.split('/').pop();
+            }
+            if (schema.type === 'array' && schema.items) {
+                return schemaName(schema.items) + '[]';
+            }
+            return schema.type || '';
+        }
+
+        function jsonContent(content) {
+            return content && content['application/json'];
+        }
+
+        function renderOperation(path, method, op) {
+            const details = el('details', 'operation');
+            const summary = el('summary');
+            summary.appendChild(el('span', 'method method-' + method, method.toUpperCase()));
+            summary.appendChild(el('span', 'path', path));
+            summary.appendChild(el('span', '', op.summary));
+            details.appendChild(summary);
+
+            const body = el('div', 'operation-body');
+            if (op.description) {
+                body.appendChild(el('p', '', op.description));
+            }
+
+            const inputs = {};
+            if (op.parameters && op.parameters.length) {
+                const table = el('table', 'params');
+                for (const param of op.parameters) {
+                    const row = el('tr');
+                    const label = el('td');
+                    label.appendChild(el('code', '', param.name));
+                    if (param.required) {
+                        label.appendChild(el('span', 'required', ' *'));
+                    }
+                    label.appendChild(el('div', 'muted', param.in + ', ' + param.schema.type));
+                    row.appendChild(label);
+                    const cell = el('td');
+                    const input = el('input');
+                    input.placeholder = param.description || '';
+                    inputs[param.name] = { param: param, input: input };
+                    cell.appendChild(input);
+                    row.appendChild(cell);
+                    table.appendChild(row);
+                }
+                body.appendChild(table);
+            }
+
+            let bodyInput = null;
+            const request = op.requestBody && jsonContent(op.requestBody.content);
+            if (request) {
+                body.appendChild(el('div', 'muted', 'Request body (' + schemaName(request.schema) + ')'));
+                bodyInput = el('textarea');
+                bodyInput.value = JSON.stringify(request.example || {}, null, 2);
+                body.appendChild(bodyInput);
+            }
+
+            const responses = el('div', 'muted');
+            responses.textContent = 'Responses: ' + Object.keys(op.responses).map(status => {
+                const media = jsonContent(op.responses[status].content);
+                return status + (media ? ' ' + schemaName(media.schema) : '');
+            }).join(', ');
+            body.appendChild(responses);
+
+            const button = el('button', 'btn', 'Send request');
+            const result = el('div');
+            button.addEventListener('click', () => send(path, method, inputs, bodyInput, result));
+            body.appendChild(button);
+            body.appendChild(result);
+
+            const schemas = el('details');
+            schemas.appendChild(el('summary', 'muted', 'Schemas'));
+            const shown = {};
+            for (const status of Object.keys(op.responses)) {
+                const media = jsonContent(op.responses[status].content);
+                if (media) {
+                    addSchema(schemas, shown, media.schema);
+                }
+            }
+            if (request) {
+                addSchema(schemas, shown, request.schema);
+            }
+            body.appendChild(schemas);
+
+            details.appendChild(body);
+            return details;
+        }
+
+        function addSchema(container, shown, schema) {
+            if (!schema) {
+                return;
+            }
+            if (schema.type === 'array' && schema.items) {
+                schema = schema.items;
+            }
+            const name = schemaName(schema);
+            if (shown[name]) {
+                return;
+            }
+            shown[name] = true;
+            container.appendChild(el('div', 'muted', name));
+            container.appendChild(el('pre', '', JSON.stringify(resolve(schema), null, 2)));
+        }
+
+        async function send(path, method, inputs, bodyInput, result) {
+            result.replaceChildren();
+            let url = path;
+            const query = new URLSearchParams();
+            for (const name of Object.keys(inputs)) {
+                const value = inputs[name].input.value;
+                if (inputs[name].param.in === 'path') {
+                    url = url.replace('{' + name + '}', encodeURIComponent(value));
+                } else if (value !== '') {
+                    query.set(name, value);
+                }
+            }
+            if (query.toString()) {
+                url += '?' + query.toString();
+            }
+
+            const options = { method: method.toUpperCase(), headers: {} };
+            if (bodyInput) {
+                options.headers['Content-Type'] = 'application/json';
+                options.body = bodyInput.value;
+            }
+
+            try {
+                const response = await fetch(url, options);
+                const text = await response.text();
+                const status = el('div', 'status ' + (response.ok ? 'status-ok' : 'status-error'),
+                    options.method + ' ' + url + ' → ' + response.status + ' ' + response.statusText);
+                result.appendChild(status);
+                result.appendChild(el('div', 'muted', 'X-Request-ID: ' + (response.headers.get('X-Request-ID') || '')));
+                let pretty = text;
+                try {
+                    pretty = JSON.stringify(JSON.parse(text), null, 2);
+                } catch (e) {
+                    // Not JSON, e.g. /metrics
+                }
+                result.appendChild(el('pre', '', pretty));
+            } catch (error) {
+                result.appendChild(el('div', 'status status-error', 'Error: ' + error.message));
+            }
+        }
+
+        async function load() {
+            const container = document.getElementById('operations');
+            try {
+                const response = await fetch('/api/openapi.json');
+                if (!response.ok) {
+                    throw new Error(response.status + ' ' + response.statusText);
+                }
+                spec = await response.json();
+            } catch (error) {
+                container.textContent = 'Failed to load the API description: ' + error.message;
+                return;
+            }
+
+            document.getElementById('api-info').textContent = spec.info.title + ' ' + spec.info.version + ' (OpenAPI ' + spec.openapi + ')';
+            const byTag = {};
+            for (const path of Object.keys(spec.paths).sort()) {
+                for (const method of Object.keys(spec.paths[path])) {
+                    const op = spec.paths[path][method];
+                    const tag = (op.tags && op.tags[0]) || 'Other';
+                    (byTag[tag] = byTag[tag] || []).push(renderOperation(path, method, op));
+                }
+            }
+            container.replaceChildren();
+            for (const tag of Object.keys(byTag).sort()) {
+                container.appendChild(el('h2', '', tag));
+                for (const node of byTag[tag]) {
+                    container.appendChild(node);
+                }
+            }
+        }
+
+        load();
+    </script>
+</body>
+</html>`
+
+func (ws *WebServer) handleExplorer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+	ws.renderPage(w, r, ws.explorer)
+}
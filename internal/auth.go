@@ -0,0 +1,391 @@
+package internal
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// TokensFileName is the file in the DB directory that holds the hashes
+	// of the API tokens.
+	TokensFileName = "tokens.json"
+	// tokenPrefix makes tokens recognizable, e.g. to secret scanners.
+	tokenPrefix = "mcm_"
+
+	sessionCookie   = "memory_session"
+	sessionLifetime = 7 * 24 * time.Hour
+)
+
+// ErrTokenNotFound is returned when revoking a token that does not exist.
+var ErrTokenNotFound = errors.New("token not found")
+
+// TokenInfo describes an API token. The token itself is only shown once,
+// when it is created; only its SHA-256 hash is stored.
+type TokenInfo struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TokenStore keeps API tokens in a file readable only by the current user.
+// It also tracks dashboard login sessions, which live in memory and end when
+// the server restarts or their token is revoked.
+//
+// The file is reread whenever it changes, so tokens created or revoked by
+// another process, such as the tokens command, take effect immediately.
+type TokenStore struct {
+	mu       sync.Mutex
+	path     string
+	modTime  time.Time            // of the file when last read or written
+	tokens   map[string]TokenInfo // by hash
+	sessions map[string]session   // by session ID
+}
+
+type session struct {
+	hash    string
+	expires time.Time
+}
+
+// LoadTokenStore reads the tokens stored at path. The file is created by the
+// first CreateToken if it does not exist yet.
+func LoadTokenStore(path string) (*TokenStore, error) {
+	ts := &TokenStore{
+		path:     path,
+		tokens:   make(map[string]TokenInfo),
+		sessions: make(map[string]session),
+	}
+
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ts, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tokens: %w", err)
+	}
+	if ts.tokens, err = readTokens(path); err != nil {
+		return nil, err
+	}
+	ts.modTime = info.ModTime()
+	return ts, nil
+}
+
+func readTokens(path string) (map[string]TokenInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tokens: %w", err)
+	}
+	var list []TokenInfo
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse tokens %s: %w", path, err)
+	}
+	tokens := make(map[string]TokenInfo, len(list))
+	for _, t := range list {
+		tokens[t.Hash] = t
+	}
+	return tokens, nil
+}
+
+// reload rereads the file if another process changed it, ending the
+// sessions of tokens that were revoked there. ts.mu must be held.
+func (ts *TokenStore) reload() {
+	info, err := os.Stat(ts.path)
+	if err != nil || info.ModTime().Equal(ts.modTime) {
+		return
+	}
+	tokens, err := readTokens(ts.path)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to reload API tokens, keeping the previous ones")
+		return
+	}
+	ts.tokens = tokens
+	ts.modTime = info.ModTime()
+	for sid, s := range ts.sessions {
+		if _, ok := ts.tokens[s.hash]; !ok {
+			delete(ts.sessions, sid)
+		}
+	}
+	log.Info().Int("count", len(tokens)).Msg("Reloaded API tokens")
+}
+
+// CreateToken generates and stores a new token named name. The returned
+// token cannot be recovered later.
+func (ts *TokenStore) CreateToken(name string) (string, TokenInfo, error) {
+	secret, err := randomString(32)
+	if err != nil {
+		return "", TokenInfo{}, err
+	}
+	id, err := randomString(6)
+	if err != nil {
+		return "", TokenInfo{}, err
+	}
+	token := tokenPrefix + secret
+	info := TokenInfo{ID: id, Name: name, Hash: hashToken(token), CreatedAt: time.Now()}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.reload()
+	ts.tokens[info.Hash] = info
+	if err := ts.save(); err != nil {
+		delete(ts.tokens, info.Hash)
+		return "", TokenInfo{}, err
+	}
+	log.Info().Str("id", id).Str("name", name).Msg("Created API token")
+	return token, info, nil
+}
+
+// RevokeToken deletes the token with the given ID and ends its sessions.
+func (ts *TokenStore) RevokeToken(id string) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.reload()
+
+	for hash, t := range ts.tokens {
+		if t.ID != id {
+			continue
+		}
+		delete(ts.tokens, hash)
+		if err := ts.save(); err != nil {
+			ts.tokens[hash] = t
+			return err
+		}
+		for sid, s := range ts.sessions {
+			if s.hash == hash {
+				delete(ts.sessions, sid)
+			}
+		}
+		log.Info().Str("id", id).Msg("Revoked API token")
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrTokenNotFound, id)
+}
+
+// Tokens returns the stored tokens, oldest first.
+func (ts *TokenStore) Tokens() []TokenInfo {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.reload()
+
+	tokens := make([]TokenInfo, 0, len(ts.tokens))
+	for _, t := range ts.tokens {
+		tokens = append(tokens, t)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreatedAt.Before(tokens[j].CreatedAt) })
+	return tokens
+}
+
+// Verify reports whether token is a stored token.
+func (ts *TokenStore) Verify(token string) (TokenInfo, bool) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.reload()
+	t, ok := ts.tokens[hashToken(token)]
+	return t, ok
+}
+
+// EnsureToken creates a token named name if none exist, so that a freshly
+// secured server can be logged into. It returns the new token, or "" if
+// tokens already existed.
+func (ts *TokenStore) EnsureToken(name string) (string, error) {
+	ts.mu.Lock()
+	ts.reload()
+	empty := len(ts.tokens) == 0
+	ts.mu.Unlock()
+	if !empty {
+		return "", nil
+	}
+	token, _, err := ts.CreateToken(name)
+	return token, err
+}
+
+func (ts *TokenStore) save() error {
+	tokens := make([]TokenInfo, 0, len(ts.tokens))
+	for _, t := range ts.tokens {
+		tokens = append(tokens, t)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreatedAt.Before(tokens[j].CreatedAt) })
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode tokens: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(ts.path), 0o700); err != nil {
+		return fmt.Errorf("failed to save tokens: %w", err)
+	}
+	if err := os.WriteFile(ts.path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to save tokens: %w", err)
+	}
+	if info, err := os.Stat(ts.path); err == nil {
+		ts.modTime = info.ModTime()
+	}
+	return nil
+}
+
+// startSession logs the holder of token in and returns a session ID for the
+// dashboard cookie.
+func (ts *TokenStore) startSession(token string) (string, bool) {
+	hash := hashToken(token)
+	id, err := randomString(32)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to generate session ID")
+		return "", false
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.reload()
+	if _, ok := ts.tokens[hash]; !ok {
+		return "", false
+	}
+	now := time.Now()
+	for sid, s := range ts.sessions {
+		if now.After(s.expires) {
+			delete(ts.sessions, sid)
+		}
+	}
+	ts.sessions[id] = session{hash: hash, expires: now.Add(sessionLifetime)}
+	return id, true
+}
+
+func (ts *TokenStore) endSession(id string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	delete(ts.sessions, id)
+}
+
+func (ts *TokenStore) validSession(id string) bool {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.reload()
+	s, ok := ts.sessions[id]
+	if !ok || time.Now().After(s.expires) {
+		return false
+	}
+	_, ok = ts.tokens[s.hash]
+	return ok
+}
+
+// authenticated reports whether r carries a valid bearer token or, if
+// cookies is set, a valid dashboard session cookie.
+func (ts *TokenStore) authenticated(r *http.Request, cookies bool) bool {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		scheme, token, ok := strings.Cut(auth, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return false
+		}
+		_, ok = ts.Verify(strings.TrimSpace(token))
+		return ok
+	}
+	if cookies {
+		if c, err := r.Cookie(sessionCookie); err == nil {
+			return ts.validSession(c.Value)
+		}
+	}
+	return false
+}
+
+// RequireToken rejects requests to next without a valid bearer token, for
+// API clients such as the HTTP MCP transport.
+func (ts *TokenStore) RequireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ts.authenticated(r, false) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="memory-server"`)
+			http.Error(w, "Unauthorized: pass an API token as 'Authorization: Bearer <token>'", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// checkRequestOrigin rejects requests that a web page on another site could
+// have sent through the user's browser. On a loopback connection the Host
+// header must name the loopback interface, which defeats DNS rebinding. The
+// Origin header, sent by browsers with cross-site requests, must match Host
+// or name the loopback interface; it is checked for every request if
+// allMethods is set and otherwise only for requests that may change state.
+// Clients other than browsers usually send no Origin and are not affected.
+func checkRequestOrigin(r *http.Request, allMethods bool) error {
+	addr, _ := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	onLoopback := false
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		onLoopback = tcp.IP.IsLoopback()
+	}
+	if onLoopback && !isLoopbackHost(hostname(r.Host)) {
+		return fmt.Errorf("host %q is not allowed", r.Host)
+	}
+
+	if !allMethods {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return nil
+		}
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("origin %q is not allowed", origin)
+	}
+	if strings.EqualFold(u.Host, r.Host) || (onLoopback && isLoopbackHost(u.Hostname())) {
+		return nil
+	}
+	return fmt.Errorf("origin %q is not allowed", origin)
+}
+
+// hostname strips the port from a Host header.
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return strings.Trim(host, "[]")
+}
+
+func isLoopbackHost(host string) bool {
+	host = strings.ToLower(host)
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// localAddr binds addr to the loopback interface unless it names a host, so
+// that ":8080" is only reachable from this machine. Use "0.0.0.0:8080" to
+// listen on all interfaces.
+func localAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host != "" {
+		return addr
+	}
+	return net.JoinHostPort("127.0.0.1", port)
+}
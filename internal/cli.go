@@ -0,0 +1,279 @@
+package internal
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// CLIClient is the Provenance.Client of documents imported on the command
+// line.
+const CLIClient = "cli"
+
+// defaultDBPath is the database used when -db-path is not given.
+const defaultDBPath = "memory.db"
+
+// RunSubcommand runs the subcommand named by args[0] with the remaining
+// arguments, if there is one by that name: "web", "export", "import" or
+// "tokens". It reports whether args named a subcommand, so that main can
+// call it first and otherwise go on to start the servers:
+//
+//	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+//	defer stop()
+//	if ok, err := internal.RunSubcommand(ctx, os.Args[1:], os.Stdin, os.Stdout); ok {
+//		if err != nil {
+//			fmt.Fprintln(os.Stderr, err)
+//			os.Exit(1)
+//		}
+//		return
+//	}
+func RunSubcommand(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer) (bool, error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+	switch args[0] {
+	case "web":
+		return true, WebCommand(ctx, args[1:])
+	case "export":
+		return true, ExportCommand(args[1:], stdout)
+	case "import":
+		return true, ImportCommand(args[1:], stdin, stdout)
+	case "tokens":
+		return true, TokensCommand(args[1:], stdout)
+	}
+	return false, nil
+}
+
+// WebCommand implements "memory-server web [flags]": it serves the dashboard
+// and REST API until ctx is cancelled. Without -db-path it starts on the
+// database picker, which finds and creates databases in -db-dir.
+//
+// Usage statistics and, with -auth, API tokens are kept in the database
+// directory, or in -db-dir for the picker. An interface other than loopback
+// is refused without -auth, since anyone who can reach it could otherwise
+// read and change every memory.
+func WebCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("web", flag.ContinueOnError)
+	dbPath := fs.String("db-path", "", "database directory (default: choose one in the browser)")
+	dbDir := fs.String("db-dir", "", "directory in which databases are chosen and created (default: working directory)")
+	port := fs.Int("web-port", 8080, "web server port")
+	host := fs.String("web-host", "", "interface to listen on (default: 127.0.0.1)")
+	requireAuth := fs.Bool("auth", false, "require an API token for the REST API and dashboard")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+	if *host != "" && !isLoopbackHost(*host) && !*requireAuth {
+		return fmt.Errorf("refusing to listen on %s without -auth", *host)
+	}
+
+	dir := *dbPath
+	if dir == "" {
+		dir = *dbDir
+	}
+	if dir == "" {
+		dir = "."
+	}
+	opts := &WebServerOptions{Host: *host, DatabaseDir: *dbDir}
+	if *requireAuth {
+		tokens, err := loadTokens(dir)
+		if err != nil {
+			return err
+		}
+		opts.Tokens = tokens
+	}
+
+	var store *MemoryStore
+	if *dbPath != "" {
+		var err error
+		if store, err = NewMemoryStore(*dbPath); err != nil {
+			return err
+		}
+		defer store.Close()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	stats, persisted := persistStats(ctx, dir)
+	err := NewWebServer(store, stats, opts).Run(ctx, *port)
+	cancel()
+	if perr := <-persisted; perr != nil {
+		log.Error().Err(perr).Msg("Failed to persist usage stats")
+	}
+	return err
+}
+
+// ExportCommand implements "memory-server export [flags]": it writes the
+// documents of a store to a file or stdout. chromem's database cannot be
+// shared between processes, so the server must not be running on the same
+// store.
+func ExportCommand(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	dbPath := fs.String("db-path", defaultDBPath, "database directory")
+	formatName := fs.String("format", "", "json, jsonl or csv (default: from the -o extension, else json)")
+	output := fs.String("o", "", "output file (default: stdout)")
+	tag := fs.String("tag", "", "only documents with this tag")
+	namespace := fs.String("namespace", "", "only documents in this namespace")
+	client := fs.String("client", "", "only documents created by this client")
+	sourceRepo := fs.String("source-repo", "", "only documents from this repository")
+	sourceFile := fs.String("source-file", "", "only documents about this file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+
+	format, err := commandFormat(*formatName, *output)
+	if err != nil {
+		return err
+	}
+	filter := DocumentFilter{
+		Tag:        *tag,
+		Provenance: Provenance{Client: *client, SourceRepo: *sourceRepo, SourceFile: *sourceFile},
+	}
+	if *namespace != "" {
+		filter.Properties = map[string]string{NamespaceProperty: *namespace}
+	}
+
+	store, err := NewMemoryStore(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	w := stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", *output, err)
+		}
+		defer f.Close()
+		w = f
+	}
+	n, err := ExportDocuments(store, w, format, filter)
+	if err != nil {
+		return err
+	}
+	if *output != "" {
+		fmt.Fprintf(stdout, "Exported %d documents to %s\n", n, *output)
+	}
+	return nil
+}
+
+// ImportCommand implements "memory-server import [flags] FILE": it adds the
+// documents in FILE ("-" for stdin) to a store and prints a report. It fails
+// if any row could not be imported.
+func ImportCommand(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	dbPath := fs.String("db-path", defaultDBPath, "database directory")
+	formatName := fs.String("format", "", "json, jsonl or csv (default: from the file extension)")
+	replace := fs.Bool("replace", false, "overwrite documents whose ID is taken")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: import [flags] FILE")
+	}
+	path := fs.Arg(0)
+
+	format, err := commandFormat(*formatName, path)
+	if err != nil {
+		return err
+	}
+
+	r := stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	store, err := NewMemoryStore(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	report, err := ImportDocuments(store, r, format, ImportOptions{Replace: *replace, Client: CLIClient})
+	fmt.Fprintln(stdout, report)
+	if err != nil {
+		return err
+	}
+	if len(report.Errors) > 0 {
+		return fmt.Errorf("%d rows could not be imported", len(report.Errors))
+	}
+	return nil
+}
+
+// TokensCommand implements "memory-server tokens [flags] list|create
+// NAME|revoke ID": it manages the API tokens of a database, which the
+// servers check when authentication is required. Only the tokens file is
+// touched, so it can run while the server is using the database; changes
+// take effect on the server's next request.
+func TokensCommand(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("tokens", flag.ContinueOnError)
+	dbPath := fs.String("db-path", defaultDBPath, "database directory")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	usage := fmt.Errorf("usage: tokens [flags] list|create NAME|revoke ID")
+	if fs.NArg() == 0 {
+		return usage
+	}
+
+	tokens, err := LoadTokenStore(filepath.Join(*dbPath, TokensFileName))
+	if err != nil {
+		return err
+	}
+	switch cmd := fs.Arg(0); {
+	case cmd == "list" && fs.NArg() == 1:
+		tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tCREATED")
+		for _, t := range tokens.Tokens() {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", t.ID, t.Name, t.CreatedAt.Format(time.RFC3339))
+		}
+		return tw.Flush()
+	case cmd == "create" && fs.NArg() == 2:
+		token, info, err := tokens.CreateToken(fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Created token %s (%s), shown only once:\n%s\n", info.ID, info.Name, token)
+		return nil
+	case cmd == "revoke" && fs.NArg() == 2:
+		if err := tokens.RevokeToken(fs.Arg(1)); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Revoked token %s\n", fs.Arg(1))
+		return nil
+	default:
+		return usage
+	}
+}
+
+// commandFormat returns the format named by the -format flag, or else the
+// one matching the extension of path. JSON is the default for stdout.
+func commandFormat(name, path string) (Format, error) {
+	if name != "" {
+		return ParseFormat(name)
+	}
+	if ext := filepath.Ext(path); ext != "" {
+		return ParseFormat(ext)
+	}
+	if path == "" || path == "-" {
+		return FormatJSON, nil
+	}
+	return "", fmt.Errorf("cannot tell the format of %s: pass -format", path)
+}
@@ -0,0 +1,166 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// shutdownTimeout bounds how long in-flight HTTP requests may take to drain.
+const shutdownTimeout = 10 * time.Second
+
+// CombinedOptions configures RunCombined.
+type CombinedOptions struct {
+	// HTTPAddr serves MCP over streamable HTTP when set.
+	HTTPAddr string
+	// SocketPath serves MCP on this Unix domain socket when set and HTTPAddr
+	// is not. If neither is set, MCP is served over stdio.
+	SocketPath string
+	// WebPort is the port of the web dashboard and REST API.
+	WebPort int
+	// WebHost is the interface the dashboard listens on; see
+	// WebServerOptions.Host.
+	WebHost string
+	// RequireAuth protects the REST API, the dashboard and the HTTP MCP
+	// transport with the API tokens stored in the database directory. If
+	// there are none yet, one is generated and printed to stderr.
+	RequireAuth bool
+	// MCP configures the MCP server; nil selects the defaults.
+	MCP *MCPServerOptions
+}
+
+// RunCombined runs the MCP server and the web dashboard in one process on the
+// same store, so changes made through one are immediately visible to the
+// other. chromem's persistent DB cannot be shared between processes, which is
+// why both front ends have to live here.
+//
+// Usage statistics are kept in the store's directory, saved periodically and
+// on shutdown, so the dashboard can show lifetime totals.
+//
+// When either server stops (stdio client disconnects, listener error, or ctx
+// is cancelled) the other one is shut down too, and RunCombined returns after
+// both have finished and the store has been closed.
+func RunCombined(ctx context.Context, store *MemoryStore, opts CombinedOptions) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	webOpts := &WebServerOptions{Host: opts.WebHost}
+	mcpOpts := &MCPServerOptions{}
+	if opts.MCP != nil {
+		*mcpOpts = *opts.MCP
+	}
+	if opts.RequireAuth {
+		tokens, err := loadTokens(store.Path())
+		if err != nil {
+			return err
+		}
+		webOpts.Tokens = tokens
+		mcpOpts.Tokens = tokens
+	}
+
+	stats, persisted := persistStats(ctx, store.Path())
+
+	mcpServer := NewMCPServer(store, stats, mcpOpts)
+	webServer := NewWebServer(store, stats, webOpts)
+	mcpServer.ForwardLogs()
+
+	errs := make(chan error, 2)
+	go func() {
+		var err error
+		switch {
+		case opts.HTTPAddr != "":
+			err = mcpServer.RunHTTP(ctx, opts.HTTPAddr)
+		case opts.SocketPath != "":
+			err = mcpServer.RunSocket(ctx, opts.SocketPath)
+		default:
+			err = mcpServer.Run(ctx)
+		}
+		log.Info().Err(err).Msg("MCP server stopped")
+		cancel()
+		errs <- err
+	}()
+	go func() {
+		err := webServer.Run(ctx, opts.WebPort)
+		log.Info().Err(err).Msg("Web server stopped")
+		cancel()
+		errs <- err
+	}()
+
+	var firstErr error
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil && !errors.Is(err, context.Canceled) && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if err := <-persisted; err != nil {
+		log.Error().Err(err).Msg("Failed to persist usage stats")
+	}
+	if err := store.Close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// serveHTTP runs srv until it fails or ctx is cancelled, in which case the
+// server is shut down gracefully and nil is returned.
+func serveHTTP(ctx context.Context, srv *http.Server) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Error().Err(err).Str("addr", srv.Addr).Msg("Failed to shut down HTTP server")
+		return err
+	}
+	return nil
+}
+
+// loadTokens loads the API tokens kept in dir, generating the first one if
+// needed. The new token is written to stderr rather than logged, because logs
+// may be forwarded to MCP clients.
+func loadTokens(dir string) (*TokenStore, error) {
+	tokens, err := LoadTokenStore(filepath.Join(dir, TokensFileName))
+	if err != nil {
+		return nil, err
+	}
+	token, err := tokens.EnsureToken("initial")
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		fmt.Fprintf(os.Stderr, "Generated API token (shown only once): %s\n", token)
+	}
+	return tokens, nil
+}
+
+// persistStats loads the usage statistics kept in dir and saves them
+// periodically until ctx is cancelled, and once more then. The channel
+// receives the result of that last save.
+func persistStats(ctx context.Context, dir string) (*UsageStats, <-chan error) {
+	stats, err := LoadUsageStats(filepath.Join(dir, StatsFileName))
+	if err != nil {
+		log.Warn().Err(err).Msg("Starting usage statistics from zero")
+		stats = NewUsageStats()
+	}
+	persisted := make(chan error, 1)
+	go func() {
+		persisted <- stats.Persist(ctx, StatsPersistInterval)
+	}()
+	return stats, persisted
+}
@@ -0,0 +1,196 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultTokenBudget is used when no token budget is given.
+	DefaultTokenBudget = 2000
+	// MinTokenBudget leaves room for the bundle header and at least one
+	// short memory.
+	MinTokenBudget = 50
+	// MaxTokenBudget bounds bundles requested over MCP and REST.
+	MaxTokenBudget = 100000
+	// maxContextCandidates bounds how many search results are considered.
+	maxContextCandidates = 200
+	// contextThreshold is the minimum similarity for a memory, favorite or
+	// not, to count as relevant.
+	contextThreshold = 0.1
+	// duplicateSimilarity is the word-set overlap above which two memories
+	// are treated as duplicates.
+	duplicateSimilarity = 0.9
+)
+
+// ContextBundle is a set of memories packed to fit a token budget.
+type ContextBundle struct {
+	Markdown  string     `json:"markdown"`
+	Documents []Document `json:"documents"`
+	// Tokens is the estimated token count of Markdown.
+	Tokens int `json:"tokens"`
+	// Omitted counts relevant memories left out for lack of budget.
+	Omitted int `json:"omitted"`
+	// Duplicates counts memories dropped as near-duplicates of included ones.
+	Duplicates int `json:"duplicates"`
+}
+
+// PackContext selects the memories most relevant to query that fit into
+// tokenBudget and renders them as a compact Markdown bundle. Relevant
+// favorites are considered first, near-duplicates are dropped, and token
+// counts are estimated locally. If memories are left out, the bundle ends
+// with a note saying so, which counts against the budget too.
+func (ms *MemoryStore) PackContext(query string, tokenBudget int, filter DocumentFilter) (ContextBundle, error) {
+	candidates, err := ms.SearchDocuments(query, maxContextCandidates, contextThreshold, filter)
+	if err != nil {
+		return ContextBundle{}, err
+	}
+
+	// Favorites first, each group by descending score
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Favorite != candidates[j].Favorite {
+			return candidates[i].Favorite
+		}
+		return candidates[i].Score > candidates[j].Score
+	})
+
+	bundle := packContext(query, candidates, tokenBudget)
+	if bundle.Omitted > 0 {
+		// Pack again leaving room for the note; no more than every
+		// candidate can be omitted, so the note cannot outgrow that.
+		reserve := EstimateTokens(omittedNote(len(candidates), tokenBudget))
+		bundle = packContext(query, candidates, tokenBudget-reserve)
+		bundle.Markdown += omittedNote(bundle.Omitted, tokenBudget)
+		bundle.Tokens = EstimateTokens(bundle.Markdown)
+	}
+	return bundle, nil
+}
+
+// omittedNote tells the reader that n relevant memories were left out.
+func omittedNote(n, tokenBudget int) string {
+	return fmt.Sprintf("\n_%d more relevant memories did not fit the %d-token budget._\n", n, tokenBudget)
+}
+
+// packContext renders the candidates that fit into tokenBudget, in order.
+func packContext(query string, candidates []Document, tokenBudget int) ContextBundle {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## Memories relevant to %q\n", query)
+	bundle := ContextBundle{Documents: []Document{}}
+	used := EstimateTokens(b.String())
+
+	var included []map[string]bool
+	for _, doc := range candidates {
+		words := wordSet(doc.Content)
+		if isDuplicate(words, included) {
+			bundle.Duplicates++
+			continue
+		}
+
+		entry := formatContextEntry(doc, doc.Content)
+		cost := EstimateTokens(entry)
+		if used+cost > tokenBudget && doc.Favorite {
+			// Shorten favorites rather than dropping them, but leave room
+			// for other memories
+			entry = fitContextEntry(doc, min(tokenBudget-used, tokenBudget/2))
+			cost = EstimateTokens(entry)
+		}
+		if entry == "" || used+cost > tokenBudget {
+			bundle.Omitted++
+			continue
+		}
+
+		b.WriteString(entry)
+		used += cost
+		included = append(included, words)
+		bundle.Documents = append(bundle.Documents, doc)
+	}
+
+	if len(bundle.Documents) == 0 && bundle.Omitted == 0 {
+		b.WriteString("\nNo relevant memories found.\n")
+	}
+	bundle.Markdown = b.String()
+	bundle.Tokens = EstimateTokens(bundle.Markdown)
+	return bundle
+}
+
+// EstimateTokens approximates the number of LLM tokens in text without a
+// tokenizer: about four characters per token for prose, but never fewer than
+// one token per word-ish piece of punctuation-heavy text such as code.
+func EstimateTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+	byChars := float64(utf8.RuneCountInString(text)) / 4
+	byWords := float64(len(strings.Fields(text))) * 4 / 3
+	return int(math.Ceil(math.Max(byChars, byWords)))
+}
+
+func formatContextEntry(doc Document, content string) string {
+	var b strings.Builder
+	b.WriteString("\n- ")
+	if doc.Favorite {
+		b.WriteString("⭐ ")
+	}
+	b.WriteString(strings.TrimSpace(content))
+	var meta []string
+	if len(doc.Tags) > 0 {
+		meta = append(meta, "tags: "+strings.Join(doc.Tags, ", "))
+	}
+	if source := doc.Provenance.String(); source != "" {
+		meta = append(meta, "source: "+source)
+	}
+	meta = append(meta, "id: "+doc.ID)
+	fmt.Fprintf(&b, " _(%s)_\n", strings.Join(meta, "; "))
+	return b.String()
+}
+
+// fitContextEntry truncates doc's content so that its entry costs at most
+// budget tokens, or returns "" if not even a short excerpt fits.
+func fitContextEntry(doc Document, budget int) string {
+	runes := []rune(doc.Content)
+	lo, hi := 0, len(runes)
+	best := ""
+	for lo <= hi {
+		mid := (lo + hi) / 2
+		entry := formatContextEntry(doc, truncateRunes(doc.Content, mid))
+		if EstimateTokens(entry) <= budget {
+			best, lo = entry, mid+1
+		} else {
+			hi = mid - 1
+		}
+	}
+	if lo-1 < 20 {
+		// An excerpt this short is not useful
+		return ""
+	}
+	return best
+}
+
+func wordSet(text string) map[string]bool {
+	words := make(map[string]bool)
+	for _, w := range strings.Fields(strings.ToLower(text)) {
+		words[strings.Trim(w, ".,;:!?\"'()[]{}")] = true
+	}
+	return words
+}
+
+// isDuplicate reports whether words overlaps any included word set by at
+// least duplicateSimilarity (Jaccard index).
+func isDuplicate(words map[string]bool, included []map[string]bool) bool {
+	for _, other := range included {
+		shared := 0
+		for w := range words {
+			if other[w] {
+				shared++
+			}
+		}
+		union := len(words) + len(other) - shared
+		if union == 0 || float64(shared)/float64(union) >= duplicateSimilarity {
+			return true
+		}
+	}
+	return false
+}
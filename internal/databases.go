@@ -0,0 +1,565 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// RecentDatabasesFileName is the file, in the user's config directory, that
+// lists recently opened databases.
+const RecentDatabasesFileName = "recent_databases.json"
+
+// maxRecentDatabases bounds the list of recently opened databases.
+const maxRecentDatabases = 20
+
+// databasesPath serves the database picker.
+const databasesPath = "/databases"
+
+// chromemMetadataFile is the file chromem keeps in every collection
+// directory; a directory with such a subdirectory is a database.
+const chromemMetadataFile = "00000000.gob"
+
+var (
+	// ErrDatabaseNotFound is returned when opening a database directory that
+	// does not exist.
+	ErrDatabaseNotFound = errors.New("database not found")
+	// ErrDatabaseExists is returned when creating a database that exists.
+	ErrDatabaseExists = errors.New("database already exists")
+)
+
+// DatabaseInfo describes a database offered by the picker.
+type DatabaseInfo struct {
+	Path       string     `json:"path"`
+	Name       string     `json:"name"`
+	LastOpened *time.Time `json:"last_opened,omitempty"`
+	Current    bool       `json:"current"`
+}
+
+// DatabaseList is returned by GET /api/databases: the open database and the
+// recently opened databases in the database directory, most recent first,
+// followed by the others found there.
+type DatabaseList struct {
+	Current   string         `json:"current,omitempty"`
+	Directory string         `json:"directory"`
+	Databases []DatabaseInfo `json:"databases"`
+}
+
+// DatabaseRequest is the body of POST /api/databases and
+// PUT /api/databases/current. Relative paths are resolved against the
+// database directory, and no path may lead out of it.
+type DatabaseRequest struct {
+	Path string `json:"path"`
+}
+
+type recentDatabase struct {
+	Path     string    `json:"path"`
+	OpenedAt time.Time `json:"opened_at"`
+}
+
+// defaultRecentDatabasesPath returns RecentDatabasesFileName in the user's
+// config directory, or in the working directory if there is none.
+func defaultRecentDatabasesPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return RecentDatabasesFileName
+	}
+	return filepath.Join(dir, "memory-server", RecentDatabasesFileName)
+}
+
+// loadRecentDatabases reads the recent databases file. A missing or corrupt
+// file yields an empty list.
+func loadRecentDatabases(path string) []recentDatabase {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Warn().Err(err).Str("path", path).Msg("Failed to read recent databases")
+		}
+		return nil
+	}
+	var recent []recentDatabase
+	if err := json.Unmarshal(data, &recent); err != nil {
+		log.Warn().Err(err).Str("path", path).Msg("Ignoring corrupt recent databases file")
+		return nil
+	}
+	return recent
+}
+
+// saveRecentDatabases moves dbPath to the front of the list in path.
+func saveRecentDatabases(path, dbPath string) error {
+	recent := []recentDatabase{{Path: dbPath, OpenedAt: time.Now().UTC()}}
+	for _, r := range loadRecentDatabases(path) {
+		if r.Path != dbPath && len(recent) < maxRecentDatabases {
+			recent = append(recent, r)
+		}
+	}
+	data, err := json.MarshalIndent(recent, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// isDatabase reports whether dir holds a chromem database.
+func isDatabase(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		for _, name := range []string{chromemMetadataFile, chromemMetadataFile + ".gz"} {
+			if _, err := os.Stat(filepath.Join(dir, e.Name(), name)); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isEmptyDir reports whether dir is a directory without entries.
+func isEmptyDir(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	return err == nil && len(entries) == 0
+}
+
+// switchesDatabases reports whether the database picker is enabled.
+func (ws *WebServer) switchesDatabases() bool {
+	return ws.opts.SwitchDatabases
+}
+
+// databaseDir returns the absolute directory in which databases are
+// discovered and created.
+func (ws *WebServer) databaseDir() string {
+	if ws.opts.DatabaseDir == "" {
+		return absPath(".")
+	}
+	return absPath(ws.opts.DatabaseDir)
+}
+
+// absPath returns path made absolute, or path itself if that fails.
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+func (ws *WebServer) recentDatabasesPath() string {
+	if ws.opts.RecentDatabasesPath != "" {
+		return ws.opts.RecentDatabasesPath
+	}
+	return defaultRecentDatabasesPath()
+}
+
+// Store returns the store currently served, or nil if none has been opened.
+func (ws *WebServer) Store() *MemoryStore {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+	return ws.store
+}
+
+// Databases lists the databases the picker offers.
+func (ws *WebServer) Databases() DatabaseList {
+	list := DatabaseList{Directory: ws.databaseDir(), Databases: []DatabaseInfo{}}
+	if store := ws.Store(); store != nil {
+		list.Current = absPath(store.Path())
+	}
+
+	recent := loadRecentDatabases(ws.recentDatabasesPath())
+	openedAt := make(map[string]time.Time, len(recent))
+	for _, r := range recent {
+		openedAt[r.Path] = r.OpenedAt
+	}
+	seen := make(map[string]bool)
+	add := func(path string) {
+		if seen[path] {
+			return
+		}
+		seen[path] = true
+		db := DatabaseInfo{Path: path, Name: filepath.Base(path), Current: path == list.Current}
+		if t, ok := openedAt[path]; ok {
+			db.LastOpened = &t
+		}
+		list.Databases = append(list.Databases, db)
+	}
+
+	if list.Current != "" {
+		add(list.Current)
+	}
+	for _, r := range recent {
+		// Databases outside the directory can no longer be opened
+		if !isBelow(list.Directory, r.Path) {
+			continue
+		}
+		if info, err := os.Stat(r.Path); err == nil && info.IsDir() {
+			add(r.Path)
+		}
+	}
+
+	entries, err := os.ReadDir(list.Directory)
+	if err != nil {
+		log.Warn().Err(err).Str("dir", list.Directory).Msg("Failed to scan for databases")
+		return list
+	}
+	var found []string
+	for _, e := range entries {
+		path := filepath.Join(list.Directory, e.Name())
+		if e.IsDir() && isDatabase(path) {
+			found = append(found, path)
+		}
+	}
+	sort.Strings(found)
+	for _, path := range found {
+		add(path)
+	}
+	return list
+}
+
+// resolveDatabase turns a path from a request into an absolute path, which
+// must lie below the database directory: requests may come from anyone who
+// can reach the port, and must not create or open directories elsewhere.
+// Symbolic links are followed as far as the path exists.
+func (ws *WebServer) resolveDatabase(path string) (string, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return "", &ValidationError{Field: "path", Reason: "must not be empty"}
+	}
+	dir := ws.databaseDir()
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	path = filepath.Clean(path)
+	if !isBelow(dir, path) {
+		return "", &ValidationError{Field: "path", Reason: "must be inside the database directory " + dir}
+	}
+	if root, err := filepath.EvalSymlinks(dir); err == nil && !isBelow(root, evalExistingSymlinks(path)) {
+		return "", &ValidationError{Field: "path", Reason: "must be inside the database directory " + dir}
+	}
+	return path, nil
+}
+
+// evalExistingSymlinks resolves the symbolic links in the longest existing
+// prefix of path, which may not exist yet.
+func evalExistingSymlinks(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path
+	}
+	return filepath.Join(evalExistingSymlinks(parent), filepath.Base(path))
+}
+
+// isBelow reports whether path is a descendant of dir; both must be clean
+// absolute paths.
+func isBelow(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// OpenDatabase opens the database at path and serves it from now on. With
+// create set the directory must not exist yet; otherwise it must be an
+// existing database or an empty directory. Requests in flight finish on the
+// previous store, which is then closed if the web server opened it.
+func (ws *WebServer) OpenDatabase(path string, create bool) (DatabaseInfo, error) {
+	path, err := ws.resolveDatabase(path)
+	if err != nil {
+		return DatabaseInfo{}, err
+	}
+
+	info, statErr := os.Stat(path)
+	switch {
+	case create && statErr == nil:
+		return DatabaseInfo{}, fmt.Errorf("%w: %s", ErrDatabaseExists, path)
+	case !create && errors.Is(statErr, os.ErrNotExist):
+		return DatabaseInfo{}, fmt.Errorf("%w: %s", ErrDatabaseNotFound, path)
+	case statErr != nil && !errors.Is(statErr, os.ErrNotExist):
+		return DatabaseInfo{}, statErr
+	case !create && !info.IsDir():
+		return DatabaseInfo{}, &ValidationError{Field: "path", Reason: path + " is not a directory"}
+	case !create && !isDatabase(path) && !isEmptyDir(path):
+		return DatabaseInfo{}, &ValidationError{Field: "path", Reason: path + " is not a memory database"}
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.store != nil && absPath(ws.store.Path()) == path {
+		return DatabaseInfo{Path: path, Name: filepath.Base(path), Current: true}, nil
+	}
+	store, err := NewMemoryStore(path)
+	if err != nil {
+		return DatabaseInfo{}, err
+	}
+	previous, owned := ws.store, ws.ownsStore
+	ws.store, ws.ownsStore = store, true
+	ws.inFlight[store] = &sync.WaitGroup{}
+	if previous != nil {
+		requests := ws.inFlight[previous]
+		delete(ws.inFlight, previous)
+		if owned {
+			ws.closing.Add(1)
+			go func() {
+				defer ws.closing.Done()
+				requests.Wait()
+				if err := previous.Close(); err != nil {
+					log.Error().Err(err).Str("path", previous.Path()).Msg("Failed to close previous memory store")
+				}
+			}()
+		}
+	}
+
+	if err := saveRecentDatabases(ws.recentDatabasesPath(), path); err != nil {
+		log.Warn().Err(err).Msg("Failed to remember recent database")
+	}
+	log.Info().Str("path", path).Bool("created", create).Msg("Switched memory store")
+	now := time.Now().UTC()
+	return DatabaseInfo{Path: path, Name: filepath.Base(path), LastOpened: &now, Current: true}, nil
+}
+
+type storeKey struct{}
+
+// withStore passes the current store to next in the request context, so a
+// request uses one store even if the database is switched meanwhile, and
+// keeps that store open until the request has finished. Without an open
+// database it responds with 503.
+func (ws *WebServer) withStore(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ws.mu.RLock()
+		store := ws.store
+		requests := ws.inFlight[store]
+		if requests != nil {
+			requests.Add(1)
+		}
+		ws.mu.RUnlock()
+		if store == nil {
+			writeError(w, r, http.StatusServiceUnavailable, codeNoDatabase, "No database is open: choose one at "+databasesPath, nil)
+			return
+		}
+		defer requests.Done()
+		next(w, r.WithContext(context.WithValue(r.Context(), storeKey{}, store)))
+	}
+}
+
+// storeOf returns the store pinned to r by withStore.
+func storeOf(r *http.Request) *MemoryStore {
+	return r.Context().Value(storeKey{}).(*MemoryStore)
+}
+
+func (ws *WebServer) handleDatabases(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, ws.Databases())
+
+	case http.MethodPost:
+		var req DatabaseRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		info, err := ws.OpenDatabase(req.Path, true)
+		if err != nil {
+			writeStoreError(w, r, err, "Failed to create database")
+			return
+		}
+		writeJSON(w, http.StatusCreated, info)
+
+	default:
+		writeMethodNotAllowed(w, r)
+	}
+}
+
+func (ws *WebServer) handleCurrentDatabase(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+	var req DatabaseRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	info, err := ws.OpenDatabase(req.Path, false)
+	if err != nil {
+		writeStoreError(w, r, err, "Failed to open database")
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func (ws *WebServer) handleDatabasePicker(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+	ws.renderPage(w, r, ws.picker)
+}
+
+// databasesHTML lists the known databases and lets users open one, create a
+// new one or open a directory of the database directory by path.
+const databasesHTML = `
+<!DOCTYPE html>
+<html>
+<head>
+    <title>Memory Server - Choose a database</title>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <style>
+        body { font-family: Arial, sans-serif; margin: 20px; background-color: #f5f5f5; }
+        .container { max-width: 900px; margin: 0 auto; background: white; padding: 20px; border-radius: 8px; box-shadow: 0 2px 4px rgba(0,0,0,0.1); }
+        .header { border-bottom: 2px solid #007bff; padding-bottom: 10px; margin-bottom: 20px; }
+        h2 { color: #333; border-bottom: 1px solid #ddd; padding-bottom: 5px; }
+        table { border-collapse: collapse; width: 100%; }
+        th, td { border-bottom: 1px solid #ddd; padding: 8px; text-align: left; }
+        .path { font-family: monospace; font-size: 12px; color: #666; }
+        .current { font-weight: bold; color: #28a745; }
+        .btn { background: #007bff; color: white; padding: 8px 16px; border: none; border-radius: 4px; cursor: pointer; }
+        .btn:disabled { background: #aaa; cursor: default; }
+        form { display: flex; gap: 10px; margin-bottom: 10px; }
+        input { flex: 1; padding: 8px; border: 1px solid #ddd; border-radius: 4px; font-family: monospace; }
+        .error { color: #dc3545; }
+        .muted { color: #666; font-size: 12px; }
+        .logout { float: right; }
+        .hidden { display: none; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            {{if .Auth}}<form method="post" action="/logout" class="logout"><button type="submit" class="btn">Log out</button></form>{{end}}
+            <h1>Choose a database</h1>
+            <p><a href="/" id="dashboard-link" class="hidden">Back to the dashboard</a> <span class="muted" id="directory"></span></p>
+        </div>
+        <p class="error" id="error"></p>
+
+        <h2>Databases</h2>
+        <table>
+            <thead><tr><th>Name</th><th>Last opened</th><th></th></tr></thead>
+            <tbody id="databases"><tr><td colspan="3">Loading...</td></tr></tbody>
+        </table>
+
+        <h2>New database</h2>
+        <form id="create-form">
+            <input id="create-path" placeholder="Name of the new database, inside the directory above" required>
+            <button type="submit" class="btn">Create</button>
+        </form>
+
+        <h2>Open by path</h2>
+        <form id="open-form">
+            <input id="open-path" placeholder="Path of an existing database, inside the directory above" required>
+            <button type="submit" class="btn">Open</button>
+        </form>
+    </div>
+
+    <script nonce="{{.Nonce}}">
+        function showError(message) {
+            document.getElementById('error').textContent = message;
+        }
+
+        async function choose(method, url, path) {
+            showError('');
+            try {
+                const response = await fetch(url, {
+                    method: method,
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ path: path })
+                });
+                if (!response.ok) {
+                    const body = await response.json().catch(() => ({}));
+                    showError(body.message || response.statusText);
+                    return;
+                }
+                window.location.href = '/';
+            } catch (error) {
+                showError(error.message);
+            }
+        }
+
+        async function load() {
+            const tbody = document.getElementById('databases');
+            let list;
+            try {
+                const response = await fetch('/api/databases');
+                list = await response.json();
+            } catch (error) {
+                showError('Failed to list databases: ' + error.message);
+                return;
+            }
+
+            document.getElementById('directory').textContent = 'Databases are opened and created in ' + list.directory;
+            if (list.current) {
+                document.getElementById('dashboard-link').className = '';
+            }
+            tbody.replaceChildren();
+            if (list.databases.length === 0) {
+                const row = document.createElement('tr');
+                const cell = document.createElement('td');
+                cell.colSpan = 3;
+                cell.textContent = 'No databases found yet. Create one below.';
+                row.appendChild(cell);
+                tbody.appendChild(row);
+            }
+            for (const db of list.databases) {
+                const row = document.createElement('tr');
+                const name = document.createElement('td');
+                name.textContent = db.name;
+                const path = document.createElement('div');
+                path.className = 'path';
+                path.textContent = db.path;
+                name.appendChild(path);
+                row.appendChild(name);
+
+                const opened = document.createElement('td');
+                opened.textContent = db.last_opened ? new Date(db.last_opened).toLocaleString() : '';
+                row.appendChild(opened);
+
+                const action = document.createElement('td');
+                if (db.current) {
+                    const current = document.createElement('span');
+                    current.className = 'current';
+                    current.textContent = 'Open';
+                    action.appendChild(current);
+                } else {
+                    const button = document.createElement('button');
+                    button.className = 'btn';
+                    button.textContent = 'Open';
+                    button.addEventListener('click', () => choose('PUT', '/api/databases/current', db.path));
+                    action.appendChild(button);
+                }
+                row.appendChild(action);
+                tbody.appendChild(row);
+            }
+        }
+
+        document.getElementById('create-form').addEventListener('submit', (e) => {
+            e.preventDefault();
+            choose('POST', '/api/databases', document.getElementById('create-path').value);
+        });
+        document.getElementById('open-form').addEventListener('submit', (e) => {
+            e.preventDefault();
+            choose('PUT', '/api/databases/current', document.getElementById('open-path').value);
+        });
+
+        load();
+    </script>
+</body>
+</html>`
@@ -0,0 +1,178 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// maxGraphImportSize bounds the memory.json content accepted by
+	// import_memory_graph.
+	maxGraphImportSize = 16 * 1024 * 1024
+	// maxGraphLineSize bounds a single line of a memory.json file.
+	maxGraphLineSize = 16 * 1024 * 1024
+)
+
+// GraphImportReport describes the outcome of importing a knowledge graph.
+type GraphImportReport struct {
+	Entities     int `json:"entities"`
+	Observations int `json:"observations"`
+	Relations    int `json:"relations"`
+	// Duplicates counts entities, observations and relations that were
+	// already stored and therefore skipped.
+	Duplicates int `json:"duplicates"`
+	// Errors lists lines that could not be imported, e.g. "line 3: ...".
+	Errors []string `json:"errors,omitempty"`
+}
+
+func (r GraphImportReport) String() string {
+	text := fmt.Sprintf("Imported %d entities, %d observations and %d relations (%d duplicates skipped)",
+		r.Entities, r.Observations, r.Relations, r.Duplicates)
+	if len(r.Errors) > 0 {
+		text += fmt.Sprintf("; %d lines failed:\n%s", len(r.Errors), strings.Join(r.Errors, "\n"))
+	}
+	return text
+}
+
+// graphRecord is one line of the reference memory server's memory.json file.
+type graphRecord struct {
+	Type string `json:"type"`
+	Entity
+	Relation
+}
+
+// Import reads a knowledge graph in the JSONL format of the reference memory
+// server: one {"type":"entity",...} or {"type":"relation",...} object per
+// line. Observations of entities that already exist are merged into them.
+// Malformed lines are reported in the result rather than aborting the import;
+// an error is only returned if reading or storing fails. progress, if not
+// nil, is called after each line.
+func (g *GraphStore) Import(r io.Reader, progress func(done, total int)) (GraphImportReport, error) {
+	var report GraphImportReport
+
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxGraphLineSize)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return report, fmt.Errorf("failed to read graph: %w", err)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	graph, err := g.readGraph()
+	if err != nil {
+		return report, err
+	}
+	entities := make(map[string]Entity)
+	for _, e := range graph.Entities {
+		entities[e.Name] = e
+	}
+	relations := make(map[Relation]bool)
+	for _, r := range graph.Relations {
+		relations[r] = true
+	}
+
+	for i, line := range lines {
+		if err := g.importLine(i+1, line, entities, relations, &report); err != nil {
+			return report, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		if progress != nil {
+			progress(i+1, len(lines))
+		}
+	}
+
+	log.Info().
+		Int("entities", report.Entities).
+		Int("observations", report.Observations).
+		Int("relations", report.Relations).
+		Int("errors", len(report.Errors)).
+		Msg("Imported knowledge graph")
+	return report, nil
+}
+
+// importLine imports one line of a memory.json file, updating the known
+// entities and relations and report. Only storage failures are returned.
+func (g *GraphStore) importLine(n int, line string, entities map[string]Entity, relations map[Relation]bool, report *GraphImportReport) error {
+	if strings.TrimSpace(line) == "" {
+		return nil
+	}
+	var record graphRecord
+	if err := json.Unmarshal([]byte(line), &record); err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("line %d: %v", n, err))
+		return nil
+	}
+
+	switch record.Type {
+	case "entity":
+		e := record.Entity
+		if e.Name == "" {
+			report.Errors = append(report.Errors, fmt.Sprintf("line %d: entity without name", n))
+			return nil
+		}
+		existing, ok := entities[e.Name]
+		if !ok {
+			if err := checkEntityType(e.EntityType); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("line %d: %v", n, err))
+				return nil
+			}
+			if err := g.addEntity(e); err != nil {
+				return err
+			}
+			entities[e.Name] = e
+			report.Entities++
+			report.Observations += len(e.Observations)
+			return nil
+		}
+
+		report.Duplicates++
+		have := make(map[string]bool)
+		for _, o := range existing.Observations {
+			have[o] = true
+		}
+		var fresh []string
+		for _, o := range e.Observations {
+			if have[o] {
+				report.Duplicates++
+				continue
+			}
+			have[o] = true
+			fresh = append(fresh, o)
+		}
+		added, err := g.addObservations(existing.Name, existing.EntityType, len(existing.Observations), fresh)
+		if err != nil {
+			return err
+		}
+		existing.Observations = append(existing.Observations, added...)
+		entities[e.Name] = existing
+		report.Observations += len(added)
+
+	case "relation":
+		r := record.Relation
+		if r.From == "" || r.To == "" || r.RelationType == "" {
+			report.Errors = append(report.Errors, fmt.Sprintf("line %d: relation needs from, to and relationType", n))
+			return nil
+		}
+		if relations[r] {
+			report.Duplicates++
+			return nil
+		}
+		if err := g.addRelation(r); err != nil {
+			return err
+		}
+		relations[r] = true
+		report.Relations++
+
+	default:
+		report.Errors = append(report.Errors, fmt.Sprintf("line %d: unknown type %q", n, record.Type))
+	}
+	return nil
+}
@@ -0,0 +1,516 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// Property keys and values that mark documents belonging to the knowledge
+// graph. Entities, observations and relations are each stored as an embedded
+// Document, in graphCollection rather than among the memories.
+const (
+	graphCollection = "knowledge_graph"
+
+	graphKindProperty         = "kg_kind"
+	graphEntityProperty       = "kg_entity"
+	graphEntityTypeProperty   = "kg_entity_type"
+	graphOrderProperty        = "kg_order"
+	graphFromProperty         = "kg_from"
+	graphToProperty           = "kg_to"
+	graphRelationTypeProperty = "kg_relation_type"
+
+	graphKindEntity      = "entity"
+	graphKindObservation = "observation"
+	graphKindRelation    = "relation"
+
+	// search_nodes adds entities with observations among the
+	// graphSearchLimit most similar ones, as long as their similarity is
+	// within graphSearchMargin of the best match. Embedding scores are only
+	// meaningful relative to each other, and substring matches are found
+	// separately.
+	graphSearchLimit  = 10
+	graphSearchMargin = 0.9
+)
+
+var (
+	// ErrEntityNotFound is returned when observations are added to or
+	// deleted from an entity that does not exist.
+	ErrEntityNotFound = errors.New("entity not found")
+	// ErrInvalidEntityType is returned for entity types containing a comma,
+	// which entities and observations are tagged with and which would
+	// therefore be split into several tags.
+	ErrInvalidEntityType = errors.New("entity type must not contain a comma")
+)
+
+// Entity, Relation and KnowledgeGraph use the JSON shape of the reference MCP
+// memory server so that prompts written for it keep working.
+type Entity struct {
+	Name         string   `json:"name"`
+	EntityType   string   `json:"entityType"`
+	Observations []string `json:"observations"`
+}
+
+type Relation struct {
+	From         string `json:"from"`
+	To           string `json:"to"`
+	RelationType string `json:"relationType"`
+}
+
+type KnowledgeGraph struct {
+	Entities  []Entity   `json:"entities"`
+	Relations []Relation `json:"relations"`
+}
+
+type ObservationInput struct {
+	EntityName string   `json:"entityName"`
+	Contents   []string `json:"contents"`
+}
+
+type ObservationResult struct {
+	EntityName        string   `json:"entityName"`
+	AddedObservations []string `json:"addedObservations"`
+}
+
+type ObservationDeletion struct {
+	EntityName   string   `json:"entityName"`
+	Observations []string `json:"observations"`
+}
+
+// GraphStore keeps a knowledge graph of entities, observations and relations
+// in the graph collection of a MemoryStore's database.
+type GraphStore struct {
+	// mu makes the check-then-add sequences below atomic with respect to
+	// each other.
+	mu    sync.Mutex
+	store *MemoryStore
+}
+
+func NewGraphStore(store *MemoryStore) *GraphStore {
+	return &GraphStore{store: store.graph}
+}
+
+// CreateEntities adds entities whose names are not taken yet, together with
+// their observations, and returns the ones that were created.
+func (g *GraphStore) CreateEntities(entities []Entity) ([]Entity, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	graph, err := g.readGraph()
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]bool)
+	for _, e := range graph.Entities {
+		existing[e.Name] = true
+	}
+
+	for _, e := range entities {
+		if err := checkEntityType(e.EntityType); err != nil {
+			return nil, err
+		}
+	}
+
+	created := []Entity{}
+	for _, e := range entities {
+		if e.Name == "" || existing[e.Name] {
+			continue
+		}
+		if err := g.addEntity(e); err != nil {
+			return created, err
+		}
+		existing[e.Name] = true
+		if e.Observations == nil {
+			e.Observations = []string{}
+		}
+		created = append(created, e)
+	}
+
+	log.Info().Int("count", len(created)).Msg("Created knowledge graph entities")
+	return created, nil
+}
+
+// CreateRelations adds relations that do not exist yet and returns them.
+func (g *GraphStore) CreateRelations(relations []Relation) ([]Relation, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	graph, err := g.readGraph()
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[Relation]bool)
+	for _, r := range graph.Relations {
+		existing[r] = true
+	}
+
+	created := []Relation{}
+	for _, r := range relations {
+		if existing[r] {
+			continue
+		}
+		if err := g.addRelation(r); err != nil {
+			return created, err
+		}
+		existing[r] = true
+		created = append(created, r)
+	}
+
+	log.Info().Int("count", len(created)).Msg("Created knowledge graph relations")
+	return created, nil
+}
+
+// AddObservations appends observations to existing entities, skipping ones
+// the entity already has. It fails if an entity does not exist.
+func (g *GraphStore) AddObservations(inputs []ObservationInput) ([]ObservationResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	graph, err := g.readGraph()
+	if err != nil {
+		return nil, err
+	}
+	entities := make(map[string]Entity)
+	for _, e := range graph.Entities {
+		entities[e.Name] = e
+	}
+
+	results := []ObservationResult{}
+	for _, in := range inputs {
+		entity, ok := entities[in.EntityName]
+		if !ok {
+			return results, fmt.Errorf("%w: %s", ErrEntityNotFound, in.EntityName)
+		}
+		have := make(map[string]bool)
+		for _, o := range entity.Observations {
+			have[o] = true
+		}
+		var fresh []string
+		for _, c := range in.Contents {
+			if !have[c] {
+				have[c] = true
+				fresh = append(fresh, c)
+			}
+		}
+
+		added, err := g.addObservations(entity.Name, entity.EntityType, len(entity.Observations), fresh)
+		if err != nil {
+			return results, err
+		}
+		entity.Observations = append(entity.Observations, added...)
+		entities[entity.Name] = entity
+		results = append(results, ObservationResult{EntityName: entity.Name, AddedObservations: added})
+	}
+	return results, nil
+}
+
+// addEntity stores e and its observations. Entity and observation documents
+// are tagged with the entity type.
+func (g *GraphStore) addEntity(e Entity) error {
+	err := g.store.AddDocument(Document{
+		ID:        uuid.New().String(),
+		Content:   fmt.Sprintf("%s (%s)", e.Name, e.EntityType),
+		CreatedAt: time.Now(),
+		Tags:      entityTags(e.EntityType),
+		Properties: map[string]string{
+			graphKindProperty:       graphKindEntity,
+			graphEntityProperty:     e.Name,
+			graphEntityTypeProperty: e.EntityType,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = g.addObservations(e.Name, e.EntityType, 0, e.Observations)
+	return err
+}
+
+func (g *GraphStore) addRelation(r Relation) error {
+	return g.store.AddDocument(Document{
+		ID:        uuid.New().String(),
+		Content:   fmt.Sprintf("%s %s %s", r.From, r.RelationType, r.To),
+		CreatedAt: time.Now(),
+		Properties: map[string]string{
+			graphKindProperty:         graphKindRelation,
+			graphFromProperty:         r.From,
+			graphToProperty:           r.To,
+			graphRelationTypeProperty: r.RelationType,
+		},
+	})
+}
+
+// checkEntityType returns ErrInvalidEntityType if entityType cannot be
+// stored as a tag.
+func checkEntityType(entityType string) error {
+	if strings.Contains(entityType, ",") {
+		return fmt.Errorf("%w: %q", ErrInvalidEntityType, entityType)
+	}
+	return nil
+}
+
+func entityTags(entityType string) []string {
+	if entityType == "" {
+		return nil
+	}
+	return []string{entityType}
+}
+
+func (g *GraphStore) addObservations(entity, entityType string, offset int, contents []string) ([]string, error) {
+	added := []string{}
+	for i, content := range contents {
+		err := g.store.AddDocument(Document{
+			ID:        uuid.New().String(),
+			Content:   content,
+			CreatedAt: time.Now(),
+			Tags:      entityTags(entityType),
+			Properties: map[string]string{
+				graphKindProperty:       graphKindObservation,
+				graphEntityProperty:     entity,
+				graphEntityTypeProperty: entityType,
+				graphOrderProperty:      strconv.Itoa(offset + i),
+			},
+		})
+		if err != nil {
+			return added, err
+		}
+		added = append(added, content)
+	}
+	return added, nil
+}
+
+// ReadGraph returns the whole knowledge graph.
+func (g *GraphStore) ReadGraph() (KnowledgeGraph, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.readGraph()
+}
+
+func (g *GraphStore) readGraph() (KnowledgeGraph, error) {
+	docs, err := g.store.ListDocuments()
+	if err != nil {
+		return KnowledgeGraph{}, err
+	}
+
+	type observation struct {
+		order   int
+		content string
+	}
+	graph := KnowledgeGraph{Entities: []Entity{}, Relations: []Relation{}}
+	observations := make(map[string][]observation)
+	for _, doc := range docs {
+		p := doc.Properties
+		switch p[graphKindProperty] {
+		case graphKindEntity:
+			graph.Entities = append(graph.Entities, Entity{Name: p[graphEntityProperty], EntityType: p[graphEntityTypeProperty]})
+		case graphKindObservation:
+			order, _ := strconv.Atoi(p[graphOrderProperty])
+			observations[p[graphEntityProperty]] = append(observations[p[graphEntityProperty]], observation{order, doc.Content})
+		case graphKindRelation:
+			graph.Relations = append(graph.Relations, Relation{From: p[graphFromProperty], To: p[graphToProperty], RelationType: p[graphRelationTypeProperty]})
+		}
+	}
+
+	sort.Slice(graph.Entities, func(i, j int) bool { return graph.Entities[i].Name < graph.Entities[j].Name })
+	sort.Slice(graph.Relations, func(i, j int) bool {
+		a, b := graph.Relations[i], graph.Relations[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.RelationType != b.RelationType {
+			return a.RelationType < b.RelationType
+		}
+		return a.To < b.To
+	})
+	for i, e := range graph.Entities {
+		obs := observations[e.Name]
+		sort.SliceStable(obs, func(i, j int) bool { return obs[i].order < obs[j].order })
+		graph.Entities[i].Observations = []string{}
+		for _, o := range obs {
+			graph.Entities[i].Observations = append(graph.Entities[i].Observations, o.content)
+		}
+	}
+	return graph, nil
+}
+
+// SearchNodes returns the entities matching query, and the relations between
+// them. Like the reference server it matches names, types and observations
+// case-insensitively as substrings; in addition, entities whose observations
+// are semantically similar to query are included.
+func (g *GraphStore) SearchNodes(query string) (KnowledgeGraph, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	graph, err := g.readGraph()
+	if err != nil {
+		return KnowledgeGraph{}, err
+	}
+
+	matched := make(map[string]bool)
+	q := strings.ToLower(query)
+	for _, e := range graph.Entities {
+		if strings.Contains(strings.ToLower(e.Name), q) || strings.Contains(strings.ToLower(e.EntityType), q) {
+			matched[e.Name] = true
+			continue
+		}
+		for _, o := range e.Observations {
+			if strings.Contains(strings.ToLower(o), q) {
+				matched[e.Name] = true
+				break
+			}
+		}
+	}
+
+	hits, err := g.store.SearchDocuments(query, graphSearchLimit, contextThreshold, DocumentFilter{
+		Properties: map[string]string{graphKindProperty: graphKindObservation},
+	})
+	if err != nil {
+		return KnowledgeGraph{}, err
+	}
+	for _, doc := range hits {
+		if doc.Score < hits[0].Score*graphSearchMargin {
+			break
+		}
+		matched[doc.Properties[graphEntityProperty]] = true
+	}
+
+	return subgraph(graph, matched), nil
+}
+
+// OpenNodes returns the named entities and the relations between them.
+func (g *GraphStore) OpenNodes(names []string) (KnowledgeGraph, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	graph, err := g.readGraph()
+	if err != nil {
+		return KnowledgeGraph{}, err
+	}
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		wanted[name] = true
+	}
+	return subgraph(graph, wanted), nil
+}
+
+// subgraph keeps the entities in names and the relations between them.
+func subgraph(graph KnowledgeGraph, names map[string]bool) KnowledgeGraph {
+	result := KnowledgeGraph{Entities: []Entity{}, Relations: []Relation{}}
+	for _, e := range graph.Entities {
+		if names[e.Name] {
+			result.Entities = append(result.Entities, e)
+		}
+	}
+	for _, r := range graph.Relations {
+		if names[r.From] && names[r.To] {
+			result.Relations = append(result.Relations, r)
+		}
+	}
+	return result
+}
+
+// EntityDocuments returns the documents that deleting the named entities
+// removes: the entities, their observations and the relations from or to
+// them. Unknown names are ignored.
+func (g *GraphStore) EntityDocuments(names []string) ([]Document, error) {
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		wanted[name] = true
+	}
+	return g.documents(func(doc Document) bool {
+		p := doc.Properties
+		switch p[graphKindProperty] {
+		case graphKindEntity, graphKindObservation:
+			return wanted[p[graphEntityProperty]]
+		case graphKindRelation:
+			return wanted[p[graphFromProperty]] || wanted[p[graphToProperty]]
+		}
+		return false
+	})
+}
+
+// ObservationDocuments returns the documents of the observations in
+// deletions. Observations an entity does not have are ignored, but the
+// entities must exist.
+func (g *GraphStore) ObservationDocuments(deletions []ObservationDeletion) ([]Document, error) {
+	g.mu.Lock()
+	graph, err := g.readGraph()
+	g.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	exists := make(map[string]bool)
+	for _, e := range graph.Entities {
+		exists[e.Name] = true
+	}
+	wanted := make(map[string]map[string]bool)
+	for _, d := range deletions {
+		if !exists[d.EntityName] {
+			return nil, fmt.Errorf("%w: %s", ErrEntityNotFound, d.EntityName)
+		}
+		if wanted[d.EntityName] == nil {
+			wanted[d.EntityName] = make(map[string]bool)
+		}
+		for _, o := range d.Observations {
+			wanted[d.EntityName][o] = true
+		}
+	}
+	return g.documents(func(doc Document) bool {
+		p := doc.Properties
+		return p[graphKindProperty] == graphKindObservation && wanted[p[graphEntityProperty]][doc.Content]
+	})
+}
+
+// RelationDocuments returns the documents of relations. Relations that do
+// not exist are ignored.
+func (g *GraphStore) RelationDocuments(relations []Relation) ([]Document, error) {
+	wanted := make(map[Relation]bool)
+	for _, r := range relations {
+		wanted[r] = true
+	}
+	return g.documents(func(doc Document) bool {
+		p := doc.Properties
+		return p[graphKindProperty] == graphKindRelation &&
+			wanted[Relation{From: p[graphFromProperty], To: p[graphToProperty], RelationType: p[graphRelationTypeProperty]}]
+	})
+}
+
+// DeleteDocuments removes graph documents returned by EntityDocuments,
+// ObservationDocuments or RelationDocuments. Documents that are already gone
+// are skipped.
+func (g *GraphStore) DeleteDocuments(docs []Document) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, doc := range docs {
+		if err := g.store.DeleteDocument(doc.ID); err != nil && !errors.Is(err, ErrDocumentNotFound) {
+			return err
+		}
+	}
+	log.Info().Int("count", len(docs)).Msg("Deleted knowledge graph documents")
+	return nil
+}
+
+// documents returns the graph documents that match.
+func (g *GraphStore) documents(match func(doc Document) bool) ([]Document, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	docs, err := g.store.ListDocuments()
+	if err != nil {
+		return nil, err
+	}
+	matched := []Document{}
+	for _, doc := range docs {
+		if match(doc) {
+			matched = append(matched, doc)
+		}
+	}
+	return matched, nil
+}
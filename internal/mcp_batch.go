@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/google/uuid"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// maxBatchSize bounds how many memories a single add_memories call may add.
+const maxBatchSize = 1000
+
+func (s *MCPServer) registerBatchTools(server *mcp.Server) {
+	type batchMemory struct {
+		Content      string            `json:"content" jsonschema:"the content of the memory document"`
+		Tags         []string          `json:"tags,omitempty" jsonschema:"Tags for the document"`
+		Favorite     bool              `json:"favorite,omitempty" jsonschema:"Mark as favorite document"`
+		Properties   map[string]string `json:"properties,omitempty" jsonschema:"Additional key-value properties"`
+		SourceFile   string            `json:"source_file,omitempty" jsonschema:"File the memory is about, relative to the repository root"`
+		SourceRepo   string            `json:"source_repo,omitempty" jsonschema:"Repository the memory comes from"`
+		SourceCommit string            `json:"source_commit,omitempty" jsonschema:"Commit the memory refers to"`
+	}
+	type addMemoriesArgs struct {
+		Memories []batchMemory `json:"memories" jsonschema:"The memories to add"`
+	}
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "add_memories",
+		Title:       "Add memories",
+		Description: "Add several memory documents at once, reporting progress",
+		InputSchema: inputSchema[addMemoriesArgs](func(props map[string]*jsonschema.Schema) {
+			props["memories"].MinItems = jsonschema.Ptr(1)
+			props["memories"].MaxItems = jsonschema.Ptr(maxBatchSize)
+			props["memories"].Items.Properties["content"].MinLength = jsonschema.Ptr(1)
+			props["memories"].Items.Properties["content"].Pattern = `\S`
+			props["memories"].Items.Properties["tags"].Items.MinLength = jsonschema.Ptr(1)
+			props["memories"].Items.Properties["tags"].UniqueItems = true
+		}),
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Add memories",
+			DestructiveHint: jsonschema.Ptr(false),
+			OpenWorldHint:   jsonschema.Ptr(false),
+		},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args addMemoriesArgs) (*mcp.CallToolResult, any, error) {
+		for i, m := range args.Memories {
+			if strings.TrimSpace(m.Content) == "" {
+				return toolError("memories[%d].content must not be empty: pass the text of the memory to store", i)
+			}
+			if msg := checkMemoryFields(m.Tags, m.Properties); msg != "" {
+				return toolError("memories[%d]: %s", i, msg)
+			}
+		}
+
+		provenance := sessionProvenance(req.Session)
+		progress := progressReporter(ctx, req, "Adding memories")
+		var ids []string
+		for i, m := range args.Memories {
+			doc := Document{
+				ID:         uuid.New().String(),
+				Content:    m.Content,
+				CreatedAt:  time.Now(),
+				Tags:       m.Tags,
+				Favorite:   m.Favorite,
+				Properties: s.scopeProperties(ctx, req.Session, m.Properties),
+				Provenance: provenance,
+			}
+			doc.Provenance.SourceFile = m.SourceFile
+			doc.Provenance.SourceRepo = m.SourceRepo
+			doc.Provenance.SourceCommit = m.SourceCommit
+			if err := s.store.AddDocument(doc); err != nil {
+				return nil, nil, fmt.Errorf("failed to add memory %d of %d (%d added): %w", i+1, len(args.Memories), len(ids), err)
+			}
+			s.stats.Record(OpAddDocument, ChannelMCP)
+			ids = append(ids, doc.ID)
+			progress(i+1, len(args.Memories))
+		}
+
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: fmt.Sprintf("Added %d memories with IDs: %s", len(ids), strings.Join(ids, ", "))},
+			},
+		}, nil, nil
+	})
+
+	type reindexMemoriesArgs struct{}
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "reindex_memories",
+		Title:       "Reindex memories",
+		Description: "Recompute the embedding of every memory document, reporting progress",
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Reindex memories",
+			DestructiveHint: jsonschema.Ptr(false),
+			IdempotentHint:  true,
+			OpenWorldHint:   jsonschema.Ptr(false),
+		},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args reindexMemoriesArgs) (*mcp.CallToolResult, any, error) {
+		count, err := s.store.Reindex(ctx, progressReporter(ctx, req, "Reindexing memories"))
+		if err != nil {
+			return nil, nil, fmt.Errorf("reindex failed after %d memories: %w", count, err)
+		}
+		s.stats.Record(OpReindex, ChannelMCP)
+
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: fmt.Sprintf("Reindexed %d memories", count)},
+			},
+		}, nil, nil
+	})
+
+}
+
+// progressReporter returns a callback that sends notifications/progress for
+// req. It is a no-op when the client did not supply a progress token.
+func progressReporter(ctx context.Context, req *mcp.CallToolRequest, message string) func(done, total int) {
+	token := req.Params.GetProgressToken()
+	if token == nil || req.Session == nil {
+		return func(int, int) {}
+	}
+	return func(done, total int) {
+		err := req.Session.NotifyProgress(ctx, &mcp.ProgressNotificationParams{
+			ProgressToken: token,
+			Message:       fmt.Sprintf("%s: %d/%d", message, done, total),
+			Progress:      float64(done),
+			Total:         float64(total),
+		})
+		if err != nil {
+			loggerFor(ctx).Debug().Err(err).Msg("Failed to send progress notification")
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// ConfirmPolicy decides what happens to a destructive tool call when the
+// client cannot ask the user for confirmation via elicitation.
+type ConfirmPolicy string
+
+const (
+	// ConfirmPolicyAllow performs the operation without confirmation.
+	ConfirmPolicyAllow ConfirmPolicy = "allow"
+	// ConfirmPolicyDeny refuses the operation.
+	ConfirmPolicyDeny ConfirmPolicy = "deny"
+)
+
+// confirmPreviewLength caps how much of each memory is shown to the user in a
+// confirmation prompt.
+const confirmPreviewLength = 300
+
+type confirmation int
+
+const (
+	confirmed confirmation = iota
+	declined
+	refused
+)
+
+// confirmDestructive asks the user, through the client, to approve an
+// operation that removes docs. Clients without elicitation support fall back
+// to the server's ConfirmPolicy. If asking fails (transport error, cancelled
+// or unanswered request) the operation is declined: a confirmation that
+// could not be obtained is not one.
+func (s *MCPServer) confirmDestructive(ctx context.Context, session *mcp.ServerSession, action string, docs []Document) confirmation {
+	if !supportsElicitation(session) {
+		return s.unconfirmed(ctx, action)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "The agent wants to %s:\n", action)
+	for _, doc := range docs {
+		fmt.Fprintf(&b, "\n[%s] %s", doc.ID, truncateRunes(doc.Content, confirmPreviewLength))
+		if len(doc.Tags) > 0 {
+			fmt.Fprintf(&b, "\nTags: %s", strings.Join(doc.Tags, ", "))
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("\nThis cannot be undone. Proceed?")
+
+	result, err := session.Elicit(ctx, &mcp.ElicitParams{
+		Message: b.String(),
+		RequestedSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"confirm": {
+					Type:        "boolean",
+					Title:       "Confirm",
+					Description: "Check to permanently " + action,
+				},
+			},
+			Required: []string{"confirm"},
+		},
+	})
+	if err != nil {
+		loggerFor(ctx).Warn().Err(err).Str("action", action).Msg("Elicitation failed, declining destructive operation")
+		return declined
+	}
+
+	if result.Action == "accept" {
+		if ok, _ := result.Content["confirm"].(bool); ok {
+			return confirmed
+		}
+	}
+	loggerFor(ctx).Info().Str("action", action).Str("response", result.Action).Msg("User did not confirm destructive operation")
+	return declined
+}
+
+func (s *MCPServer) unconfirmed(ctx context.Context, action string) confirmation {
+	if s.opts.UnconfirmedDeletes == ConfirmPolicyDeny {
+		loggerFor(ctx).Info().Str("action", action).Msg("Refusing destructive operation without confirmation")
+		return refused
+	}
+	return confirmed
+}
+
+func supportsElicitation(session *mcp.ServerSession) bool {
+	if session == nil {
+		return false
+	}
+	params := session.InitializeParams()
+	return params != nil && params.Capabilities != nil && params.Capabilities.Elicitation != nil
+}
+
+// truncateRunes shortens s to at most n runes, marking the cut with an ellipsis.
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "…"
+}
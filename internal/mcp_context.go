@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func (s *MCPServer) registerContextTool(server *mcp.Server) {
+	type getContextArgs struct {
+		Query       string `json:"query" jsonschema:"What the agent is working on"`
+		TokenBudget int    `json:"token_budget,omitempty" jsonschema:"Maximum size of the bundle in tokens (default 2000)"`
+		Tag         string `json:"tag,omitempty" jsonschema:"Only include memories with this tag"`
+		Namespace   string `json:"namespace,omitempty" jsonschema:"Only include memories in this namespace"`
+	}
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "get_context",
+		Title:       "Get context",
+		Description: "Return the most relevant memories that fit into a token budget as a compact Markdown bundle. Relevant favorites are always considered first and near-duplicates are removed.",
+		InputSchema: inputSchema[getContextArgs](func(props map[string]*jsonschema.Schema) {
+			props["query"].MinLength = jsonschema.Ptr(1)
+			props["query"].Pattern = `\S`
+			props["token_budget"].Minimum = jsonschema.Ptr(float64(MinTokenBudget))
+			props["token_budget"].Maximum = jsonschema.Ptr(float64(MaxTokenBudget))
+			props["token_budget"].Default = json.RawMessage(strconv.Itoa(DefaultTokenBudget))
+		}),
+		Annotations: &mcp.ToolAnnotations{
+			Title:         "Get context",
+			ReadOnlyHint:  true,
+			OpenWorldHint: jsonschema.Ptr(false),
+		},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args getContextArgs) (*mcp.CallToolResult, any, error) {
+		if strings.TrimSpace(args.Query) == "" {
+			return toolError("query must not be empty: describe what you are working on")
+		}
+		if args.TokenBudget < MinTokenBudget || args.TokenBudget > MaxTokenBudget {
+			return toolError("token_budget must be between %d and %d, got %d", MinTokenBudget, MaxTokenBudget, args.TokenBudget)
+		}
+
+		filter := DocumentFilter{Tag: args.Tag}
+		if args.Namespace != "" {
+			filter.Properties = map[string]string{NamespaceProperty: args.Namespace}
+		}
+		s.scopeFilter(ctx, req.Session, &filter)
+
+		s.stats.Record(OpGetContext, ChannelMCP)
+		bundle, err := s.store.PackContext(args.Query, args.TokenBudget, filter)
+		if err != nil {
+			return nil, nil, fmt.Errorf("get context failed: %w", err)
+		}
+
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: bundle.Markdown},
+			},
+		}, nil, nil
+	})
+}
@@ -0,0 +1,322 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// registerGraphTools adds the knowledge-graph tools of the reference MCP
+// memory server. Names, arguments and results match it, so prompts written
+// for that server work unchanged.
+func (s *MCPServer) registerGraphTools(server *mcp.Server) {
+	type createEntitiesArgs struct {
+		Entities []Entity `json:"entities" jsonschema:"Entities to create"`
+	}
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "create_entities",
+		Title:       "Create entities",
+		Description: "Create multiple new entities in the knowledge graph. Entities whose name already exists are skipped.",
+		InputSchema: inputSchema[createEntitiesArgs](func(props map[string]*jsonschema.Schema) {
+			entity := props["entities"].Items
+			entity.Required = []string{"name", "entityType", "observations"}
+			entity.Properties["name"].Description = "The name of the entity"
+			entity.Properties["entityType"].Description = "The type of the entity"
+			entity.Properties["observations"].Description = "Observations about the entity"
+		}),
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Create entities",
+			DestructiveHint: jsonschema.Ptr(false),
+			IdempotentHint:  true,
+			OpenWorldHint:   jsonschema.Ptr(false),
+		},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args createEntitiesArgs) (*mcp.CallToolResult, any, error) {
+		created, err := s.graph.CreateEntities(args.Entities)
+		if errors.Is(err, ErrInvalidEntityType) {
+			return toolError("%v: use a single type such as \"person\"", err)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("create entities failed: %w", err)
+		}
+		s.stats.Record(OpGraphWrite, ChannelMCP)
+		return graphResult(created)
+	})
+
+	type createRelationsArgs struct {
+		Relations []Relation `json:"relations" jsonschema:"Relations to create, in active voice"`
+	}
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "create_relations",
+		Title:       "Create relations",
+		Description: "Create multiple new relations between entities in the knowledge graph. Relations should be in active voice. Existing relations are skipped.",
+		InputSchema: inputSchema[createRelationsArgs](func(props map[string]*jsonschema.Schema) {
+			relation := props["relations"].Items
+			relation.Required = []string{"from", "to", "relationType"}
+			relation.Properties["from"].Description = "The name of the entity where the relation starts"
+			relation.Properties["to"].Description = "The name of the entity where the relation ends"
+			relation.Properties["relationType"].Description = "The type of the relation"
+		}),
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Create relations",
+			DestructiveHint: jsonschema.Ptr(false),
+			IdempotentHint:  true,
+			OpenWorldHint:   jsonschema.Ptr(false),
+		},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args createRelationsArgs) (*mcp.CallToolResult, any, error) {
+		created, err := s.graph.CreateRelations(args.Relations)
+		if err != nil {
+			return nil, nil, fmt.Errorf("create relations failed: %w", err)
+		}
+		s.stats.Record(OpGraphWrite, ChannelMCP)
+		return graphResult(created)
+	})
+
+	type addObservationsArgs struct {
+		Observations []ObservationInput `json:"observations" jsonschema:"Observations to add to existing entities"`
+	}
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "add_observations",
+		Title:       "Add observations",
+		Description: "Add new observations to existing entities in the knowledge graph. Observations the entity already has are skipped.",
+		InputSchema: inputSchema[addObservationsArgs](func(props map[string]*jsonschema.Schema) {
+			observation := props["observations"].Items
+			observation.Required = []string{"entityName", "contents"}
+			observation.Properties["entityName"].Description = "The name of the entity to add the observations to"
+			observation.Properties["contents"].Description = "The observations to add"
+		}),
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Add observations",
+			DestructiveHint: jsonschema.Ptr(false),
+			IdempotentHint:  true,
+			OpenWorldHint:   jsonschema.Ptr(false),
+		},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args addObservationsArgs) (*mcp.CallToolResult, any, error) {
+		results, err := s.graph.AddObservations(args.Observations)
+		if errors.Is(err, ErrEntityNotFound) {
+			return toolError("%v: create it with create_entities first", err)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("add observations failed: %w", err)
+		}
+		s.stats.Record(OpGraphWrite, ChannelMCP)
+		return graphResult(results)
+	})
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "read_graph",
+		Title:       "Read graph",
+		Description: "Read the entire knowledge graph.",
+		Annotations: &mcp.ToolAnnotations{
+			Title:         "Read graph",
+			ReadOnlyHint:  true,
+			OpenWorldHint: jsonschema.Ptr(false),
+		},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args struct{}) (*mcp.CallToolResult, any, error) {
+		result, err := s.graph.ReadGraph()
+		if err != nil {
+			return nil, nil, fmt.Errorf("read graph failed: %w", err)
+		}
+		s.stats.Record(OpGraphRead, ChannelMCP)
+		return graphResult(result)
+	})
+
+	type searchNodesArgs struct {
+		Query string `json:"query" jsonschema:"The search query to match against entity names, types and observation content"`
+	}
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "search_nodes",
+		Title:       "Search nodes",
+		Description: "Search for nodes in the knowledge graph by name, type or observation content, including semantically similar observations.",
+		InputSchema: inputSchema[searchNodesArgs](func(props map[string]*jsonschema.Schema) {
+			props["query"].MinLength = jsonschema.Ptr(1)
+		}),
+		Annotations: &mcp.ToolAnnotations{
+			Title:         "Search nodes",
+			ReadOnlyHint:  true,
+			OpenWorldHint: jsonschema.Ptr(false),
+		},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args searchNodesArgs) (*mcp.CallToolResult, any, error) {
+		result, err := s.graph.SearchNodes(args.Query)
+		if err != nil {
+			return nil, nil, fmt.Errorf("search nodes failed: %w", err)
+		}
+		s.stats.Record(OpGraphRead, ChannelMCP)
+		return graphResult(result)
+	})
+
+	type openNodesArgs struct {
+		Names []string `json:"names" jsonschema:"The names of the entities to retrieve"`
+	}
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "open_nodes",
+		Title:       "Open nodes",
+		Description: "Open specific nodes in the knowledge graph by their names, with the relations between them.",
+		Annotations: &mcp.ToolAnnotations{
+			Title:         "Open nodes",
+			ReadOnlyHint:  true,
+			OpenWorldHint: jsonschema.Ptr(false),
+		},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args openNodesArgs) (*mcp.CallToolResult, any, error) {
+		result, err := s.graph.OpenNodes(args.Names)
+		if err != nil {
+			return nil, nil, fmt.Errorf("open nodes failed: %w", err)
+		}
+		s.stats.Record(OpGraphRead, ChannelMCP)
+		return graphResult(result)
+	})
+
+	type deleteEntitiesArgs struct {
+		EntityNames []string `json:"entityNames" jsonschema:"The names of the entities to delete"`
+	}
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "delete_entities",
+		Title:       "Delete entities",
+		Description: "Delete multiple entities and their associated relations from the knowledge graph.",
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Delete entities",
+			DestructiveHint: jsonschema.Ptr(true),
+			IdempotentHint:  true,
+			OpenWorldHint:   jsonschema.Ptr(false),
+		},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args deleteEntitiesArgs) (*mcp.CallToolResult, any, error) {
+		docs, err := s.graph.EntityDocuments(args.EntityNames)
+		if err != nil {
+			return nil, nil, fmt.Errorf("delete entities failed: %w", err)
+		}
+		return s.deleteGraphDocuments(ctx, req.Session, "delete these entities with their observations and relations", docs, "Entities deleted successfully")
+	})
+
+	type deleteObservationsArgs struct {
+		Deletions []ObservationDeletion `json:"deletions" jsonschema:"Observations to delete from entities"`
+	}
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "delete_observations",
+		Title:       "Delete observations",
+		Description: "Delete specific observations from entities in the knowledge graph.",
+		InputSchema: inputSchema[deleteObservationsArgs](func(props map[string]*jsonschema.Schema) {
+			deletion := props["deletions"].Items
+			deletion.Required = []string{"entityName", "observations"}
+			deletion.Properties["entityName"].Description = "The name of the entity containing the observations"
+			deletion.Properties["observations"].Description = "The observations to delete"
+		}),
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Delete observations",
+			DestructiveHint: jsonschema.Ptr(true),
+			IdempotentHint:  true,
+			OpenWorldHint:   jsonschema.Ptr(false),
+		},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args deleteObservationsArgs) (*mcp.CallToolResult, any, error) {
+		docs, err := s.graph.ObservationDocuments(args.Deletions)
+		if errors.Is(err, ErrEntityNotFound) {
+			return toolError("%v: use search_nodes or read_graph to find its name", err)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("delete observations failed: %w", err)
+		}
+		return s.deleteGraphDocuments(ctx, req.Session, "delete these observations", docs, "Observations deleted successfully")
+	})
+
+	type deleteRelationsArgs struct {
+		Relations []Relation `json:"relations" jsonschema:"Relations to delete"`
+	}
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "delete_relations",
+		Title:       "Delete relations",
+		Description: "Delete multiple relations from the knowledge graph.",
+		InputSchema: inputSchema[deleteRelationsArgs](func(props map[string]*jsonschema.Schema) {
+			relation := props["relations"].Items
+			relation.Required = []string{"from", "to", "relationType"}
+			relation.Properties["from"].Description = "The name of the entity where the relation starts"
+			relation.Properties["to"].Description = "The name of the entity where the relation ends"
+			relation.Properties["relationType"].Description = "The type of the relation"
+		}),
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Delete relations",
+			DestructiveHint: jsonschema.Ptr(true),
+			IdempotentHint:  true,
+			OpenWorldHint:   jsonschema.Ptr(false),
+		},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args deleteRelationsArgs) (*mcp.CallToolResult, any, error) {
+		docs, err := s.graph.RelationDocuments(args.Relations)
+		if err != nil {
+			return nil, nil, fmt.Errorf("delete relations failed: %w", err)
+		}
+		return s.deleteGraphDocuments(ctx, req.Session, "delete these relations", docs, "Relations deleted successfully")
+	})
+
+	type importGraphArgs struct {
+		Content string `json:"content" jsonschema:"The contents of a memory.json file: one JSON entity or relation per line"`
+	}
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "import_memory_graph",
+		Title:       "Import memory graph",
+		Description: "Import a knowledge graph in the memory.json format of the reference MCP memory server, reporting progress. Observations of existing entities are merged; already imported items are skipped.",
+		InputSchema: inputSchema[importGraphArgs](func(props map[string]*jsonschema.Schema) {
+			props["content"].MinLength = jsonschema.Ptr(1)
+			props["content"].MaxLength = jsonschema.Ptr(maxGraphImportSize)
+		}),
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Import memory graph",
+			DestructiveHint: jsonschema.Ptr(false),
+			IdempotentHint:  true,
+			OpenWorldHint:   jsonschema.Ptr(false),
+		},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args importGraphArgs) (*mcp.CallToolResult, any, error) {
+		report, err := s.graph.Import(strings.NewReader(args.Content), progressReporter(ctx, req, "Importing graph"))
+		if err != nil {
+			return nil, nil, fmt.Errorf("import failed (%s): %w", report, err)
+		}
+		s.stats.Record(OpGraphWrite, ChannelMCP)
+
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: report.String()},
+			},
+		}, nil, nil
+	})
+}
+
+// deleteGraphDocuments deletes docs once the user confirms action, like
+// delete_memory, and answers with done as the reference server does.
+func (s *MCPServer) deleteGraphDocuments(ctx context.Context, session *mcp.ServerSession, action string, docs []Document, done string) (*mcp.CallToolResult, any, error) {
+	if len(docs) > 0 {
+		switch s.confirmDestructive(ctx, session, action, docs) {
+		case declined:
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: "The user did not confirm the deletion; the knowledge graph was kept"},
+				},
+			}, nil, nil
+		case refused:
+			return toolError("deleting from the knowledge graph requires user confirmation, which this client does not support")
+		}
+		if err := s.graph.DeleteDocuments(docs); err != nil {
+			return nil, nil, fmt.Errorf("delete failed: %w", err)
+		}
+		s.stats.Record(OpGraphWrite, ChannelMCP)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: done},
+		},
+	}, nil, nil
+}
+
+// graphResult returns v as indented JSON text, which is how the reference
+// server answers every knowledge-graph tool.
+func graphResult(v any) (*mcp.CallToolResult, any, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode result: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: string(data)},
+		},
+	}, nil, nil
+}
@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync/atomic"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+var mcpLogLevels = map[zerolog.Level]mcp.LoggingLevel{
+	zerolog.DebugLevel: "debug",
+	zerolog.InfoLevel:  "info",
+	zerolog.WarnLevel:  "warning",
+	zerolog.ErrorLevel: "error",
+	zerolog.FatalLevel: "critical",
+	zerolog.PanicLevel: "emergency",
+}
+
+// sessionLogWriter forwards zerolog events to one MCP client as
+// notifications/message, with all their fields as the data. The SDK drops
+// messages below the level the client set with logging/setLevel, and sends
+// nothing until it has set one.
+type sessionLogWriter struct {
+	session *mcp.ServerSession
+}
+
+func (w sessionLogWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (w sessionLogWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	mcpLevel, ok := mcpLogLevels[level]
+	if !ok {
+		return len(p), nil
+	}
+	var data map[string]any
+	if err := json.Unmarshal(p, &data); err != nil {
+		return len(p), nil
+	}
+	delete(data, zerolog.LevelFieldName)
+	// The request may already be done, so the notification gets a context
+	// of its own. Errors are ignored: logging them would recurse into this
+	// writer.
+	_ = w.session.Log(context.Background(), &mcp.LoggingMessageParams{
+		Level:  mcpLevel,
+		Logger: "memory-server",
+		Data:   data,
+	})
+	return len(p), nil
+}
+
+// logForwarding is set by ForwardLogs.
+type logForwarding struct {
+	enabled atomic.Bool
+}
+
+// ForwardLogs makes the log events of each client's requests also go to that
+// client as notifications/message. Other clients never see them, and events
+// outside of MCP requests (web requests, startup) are not forwarded. Logs
+// keep going to stderr as before.
+func (s *MCPServer) ForwardLogs() {
+	s.forwarding.enabled.Store(true)
+}
+
+// withSessionLogger gives every incoming request a logger, available through
+// loggerFor, that names the session and, once ForwardLogs has been called,
+// also sends its events to that session. The global logger is left alone.
+// Failed requests and tool calls are logged with it, so that the client sees
+// errors of the store as well.
+func (s *MCPServer) withSessionLogger(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		logger := log.Logger
+		if session, ok := req.GetSession().(*mcp.ServerSession); ok && session != nil {
+			if id := session.ID(); id != "" {
+				logger = logger.With().Str("session", id).Logger()
+			}
+			if s.forwarding.enabled.Load() {
+				logger = logger.Output(zerolog.MultiLevelWriter(s.logOutput(), sessionLogWriter{session: session}))
+			}
+		}
+		res, err := next(logger.WithContext(ctx), method, req)
+		if err != nil {
+			logger.Warn().Err(err).Str("method", method).Msg("MCP request failed")
+		} else if result, ok := res.(*mcp.CallToolResult); ok && result.IsError {
+			event := logger.Warn()
+			if call, ok := req.(*mcp.CallToolRequest); ok {
+				event = event.Str("tool", call.Params.Name)
+			}
+			if len(result.Content) > 0 {
+				if text, ok := result.Content[0].(*mcp.TextContent); ok {
+					event = event.Str("error", text.Text)
+				}
+			}
+			event.Msg("Tool call failed")
+		}
+		return res, err
+	}
+}
+
+// logOutput returns where log events go besides the client when they are
+// forwarded: MCPServerOptions.LogOutput, or stderr.
+func (s *MCPServer) logOutput() io.Writer {
+	if s.opts.LogOutput != nil {
+		return s.opts.LogOutput
+	}
+	return os.Stderr
+}
+
+// loggerFor returns the logger attached to ctx by withSessionLogger, or the
+// global logger outside of an MCP request.
+func loggerFor(ctx context.Context) *zerolog.Logger {
+	if logger := zerolog.Ctx(ctx); logger.GetLevel() != zerolog.Disabled {
+		return logger
+	}
+	return &log.Logger
+}
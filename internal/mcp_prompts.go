@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// maxCompletionValues is the most values a completion/complete response may
+// carry according to the MCP specification.
+const maxCompletionValues = 100
+
+func (s *MCPServer) registerPrompts(server *mcp.Server) {
+	server.AddPrompt(&mcp.Prompt{
+		Name:        "recall",
+		Title:       "Recall memories",
+		Description: "Load the memories relevant to a topic into the conversation",
+		Arguments: []*mcp.PromptArgument{
+			{Name: "query", Description: "What the memories should be about", Required: true},
+			{Name: "tag", Description: "Only include memories with this tag"},
+			{Name: "namespace", Description: "Only include memories in this namespace"},
+		},
+	}, func(ctx context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		args := req.Params.Arguments
+		filter := DocumentFilter{Tag: args["tag"]}
+		if args["namespace"] != "" {
+			filter.Properties = map[string]string{NamespaceProperty: args["namespace"]}
+		}
+		s.scopeFilter(ctx, req.Session, &filter)
+
+		s.stats.Record(OpSearch, ChannelMCP)
+		docs, err := s.store.SearchDocuments(args["query"], defaultSearchLimit, defaultSearchThreshold, filter)
+		if err != nil {
+			return nil, fmt.Errorf("search failed: %w", err)
+		}
+		return memoriesPrompt(fmt.Sprintf("Memories relevant to %q", args["query"]), docs), nil
+	})
+
+	server.AddPrompt(&mcp.Prompt{
+		Name:        "memories_with_property",
+		Title:       "Memories with property",
+		Description: "Load all memories that carry a given property, optionally with a specific value",
+		Arguments: []*mcp.PromptArgument{
+			{Name: "property", Description: "Property key", Required: true},
+			{Name: "value", Description: "Only include memories where the property has this value"},
+		},
+	}, func(ctx context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		key, value := req.Params.Arguments["property"], req.Params.Arguments["value"]
+
+		s.stats.Record(OpGetAllDocuments, ChannelMCP)
+		all, err := s.store.ListDocuments()
+		if err != nil {
+			return nil, fmt.Errorf("list failed: %w", err)
+		}
+		var docs []Document
+		for _, doc := range all {
+			if v, ok := doc.Properties[key]; ok && (value == "" || v == value) {
+				docs = append(docs, doc)
+			}
+		}
+		title := fmt.Sprintf("Memories with property %q", key)
+		if value != "" {
+			title = fmt.Sprintf("Memories with %s=%q", key, value)
+		}
+		return memoriesPrompt(title, docs), nil
+	})
+}
+
+func memoriesPrompt(title string, docs []Document) *mcp.GetPromptResult {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (%d found). Use them as context for the task at hand:\n", title, len(docs))
+	for _, doc := range docs {
+		fmt.Fprintf(&b, "\n- [%s] %s", doc.ID, doc.Content)
+		if len(doc.Tags) > 0 {
+			fmt.Fprintf(&b, " (tags: %s)", strings.Join(doc.Tags, ", "))
+		}
+	}
+
+	return &mcp.GetPromptResult{
+		Description: title,
+		Messages: []*mcp.PromptMessage{
+			{Role: "user", Content: &mcp.TextContent{Text: b.String()}},
+		},
+	}
+}
+
+// complete implements completion/complete. Arguments are completed by name
+// from the values actually present in the store, so the same argument names
+// behave alike across prompts.
+func (s *MCPServer) complete(ctx context.Context, req *mcp.CompleteRequest) (*mcp.CompleteResult, error) {
+	var (
+		candidates []string
+		err        error
+	)
+	switch req.Params.Argument.Name {
+	case "tag", "tags":
+		candidates, err = s.store.Tags()
+	case NamespaceProperty:
+		candidates, err = s.store.PropertyValues(NamespaceProperty)
+	case "property", "property_key":
+		candidates, err = s.store.PropertyKeys()
+	case "value":
+		if req.Params.Context != nil && req.Params.Context.Arguments["property"] != "" {
+			candidates, err = s.store.PropertyValues(req.Params.Context.Arguments["property"])
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("completion failed: %w", err)
+	}
+
+	return &mcp.CompleteResult{Completion: completionFor(candidates, req.Params.Argument.Value)}, nil
+}
+
+// completionFor returns the candidates that start with prefix, ignoring case,
+// capped at maxCompletionValues.
+func completionFor(candidates []string, prefix string) mcp.CompletionResultDetails {
+	prefix = strings.ToLower(prefix)
+	values := []string{}
+	for _, c := range candidates {
+		if strings.HasPrefix(strings.ToLower(c), prefix) {
+			values = append(values, c)
+		}
+	}
+	sort.Strings(values)
+
+	details := mcp.CompletionResultDetails{Values: values, Total: len(values)}
+	if len(values) > maxCompletionValues {
+		details.Values = values[:maxCompletionValues]
+		details.HasMore = true
+	}
+	return details
+}
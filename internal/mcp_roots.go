@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// rootsTimeout bounds how long we wait for a client to answer roots/list.
+const rootsTimeout = 10 * time.Second
+
+// projectLookup is the project of a session, known once done is closed.
+type projectLookup struct {
+	done    chan struct{}
+	project string
+}
+
+// projectFor returns the project the session's client is working in, derived
+// from its first workspace root, or "" if it has none. Clients are only asked
+// if they support roots, and only once per session: concurrent calls wait for
+// the same answer, which is cached until the client reports that its roots
+// changed.
+func (s *MCPServer) projectFor(ctx context.Context, session *mcp.ServerSession) string {
+	if s.opts.IgnoreRoots || session == nil {
+		return ""
+	}
+
+	s.mu.Lock()
+	lookup, ok := s.projects[session]
+	if !ok {
+		lookup = &projectLookup{done: make(chan struct{})}
+		// Drop sessions that have disconnected since the last lookup.
+		live := make(map[*mcp.ServerSession]bool)
+		for ss := range s.server.Sessions() {
+			live[ss] = true
+		}
+		for ss := range s.projects {
+			if !live[ss] {
+				delete(s.projects, ss)
+			}
+		}
+		s.projects[session] = lookup
+	}
+	s.mu.Unlock()
+	if ok {
+		select {
+		case <-lookup.done:
+			return lookup.project
+		case <-ctx.Done():
+			return ""
+		}
+	}
+
+	defer close(lookup.done)
+	if !supportsRoots(session) {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(ctx, rootsTimeout)
+	defer cancel()
+	result, err := session.ListRoots(ctx, nil)
+	if err != nil {
+		// Don't ask again: the answer is cached like any other.
+		loggerFor(ctx).Debug().Err(err).Msg("Failed to list client roots")
+		return ""
+	}
+	lookup.project = projectFromRoots(result.Roots)
+	loggerFor(ctx).Info().Str("project", lookup.project).Msg("Scoped MCP session to project")
+	return lookup.project
+}
+
+// supportsRoots reports whether the client answers roots/list. The SDK
+// cannot tell an empty roots capability from a missing one, so clients that
+// do not announce roots/list_changed notifications count as not supporting
+// roots.
+func supportsRoots(session *mcp.ServerSession) bool {
+	params := session.InitializeParams()
+	return params != nil && params.Capabilities != nil && params.Capabilities.Roots.ListChanged
+}
+
+// forgetRoots drops the cached project so it is re-read on next use.
+func (s *MCPServer) forgetRoots(session *mcp.ServerSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.projects, session)
+}
+
+// projectFromRoots names the project after the directory of the first root,
+// falling back to the root's display name.
+func projectFromRoots(roots []*mcp.Root) string {
+	for _, root := range roots {
+		if u, err := url.Parse(root.URI); err == nil && u.Scheme == "file" {
+			if name := path.Base(path.Clean(u.Path)); name != "/" && name != "." {
+				return name
+			}
+		}
+		if root.Name != "" {
+			return root.Name
+		}
+	}
+	return ""
+}
+
+// scopeFilter prefers memories from the session's project unless the caller
+// already restricted the search to a namespace.
+func (s *MCPServer) scopeFilter(ctx context.Context, session *mcp.ServerSession, filter *DocumentFilter) {
+	if _, ok := filter.Properties[NamespaceProperty]; ok {
+		return
+	}
+	if project := s.projectFor(ctx, session); project != "" {
+		filter.Prefer = map[string]string{NamespaceProperty: project}
+	}
+}
+
+// scopeProperties defaults the namespace of a new memory to the session's
+// project.
+func (s *MCPServer) scopeProperties(ctx context.Context, session *mcp.ServerSession, props map[string]string) map[string]string {
+	if props[NamespaceProperty] != "" {
+		return props
+	}
+	project := s.projectFor(ctx, session)
+	if project == "" {
+		return props
+	}
+	scoped := make(map[string]string, len(props)+1)
+	for k, v := range props {
+		scoped[k] = v
+	}
+	scoped[NamespaceProperty] = project
+	return scoped
+}
@@ -2,84 +2,244 @@ package internal
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/google/jsonschema-go/jsonschema"
 	"github.com/google/uuid"
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rs/zerolog/log"
 )
 
+const (
+	defaultSearchLimit     = 10
+	maxSearchLimit         = 100
+	defaultSearchThreshold = 0.1
+)
+
+// serverInstructions is sent to clients on initialize to tell agents how the
+// memory store is meant to be used.
+const serverInstructions = `This server is a persistent, local memory store shared across sessions, IDEs and projects.
+
+- Before starting a task, call search_memories with a short description of the task to recall relevant bug fixes, decisions and conventions.
+- After solving a non-obvious problem or making a decision worth keeping, call add_memory with a concise, self-contained note. Add a few lowercase tags and mark it favorite only if it is broadly important.
+- Similarity is statistical, not semantic: use the key terms the memory would contain. Lower the threshold if nothing is found.
+- delete_memory permanently removes a memory. Only delete an ID you obtained from search_memories or list_memories, and only when the user asked for it. The user may be asked to confirm.`
+
 type MCPServer struct {
 	store  *MemoryStore
+	graph  *GraphStore
+	stats  *UsageStats
+	opts   MCPServerOptions
 	server *mcp.Server
+
+	mu       sync.Mutex
+	projects map[*mcp.ServerSession]*projectLookup // see projectFor
+
+	forwarding logForwarding // see ForwardLogs
 }
 
-func NewMCPServer(store *MemoryStore) *MCPServer {
+// MCPServerOptions configures optional MCP server behaviour. A nil
+// *MCPServerOptions selects the defaults.
+type MCPServerOptions struct {
+	// UnconfirmedDeletes applies to destructive tools when the client does
+	// not support elicitation, so the user cannot be asked to confirm.
+	// Defaults to ConfirmPolicyAllow.
+	UnconfirmedDeletes ConfirmPolicy
+	// IgnoreRoots disables scoping memories to the project named by the
+	// client's first workspace root.
+	IgnoreRoots bool
+	// KnowledgeGraph adds the entity/relation tools of the reference MCP
+	// memory server, stored in the same MemoryStore.
+	KnowledgeGraph bool
+	// Tokens, if set, requires an API token for the HTTP transport.
+	Tokens *TokenStore
+	// LogOutput receives the log events of MCP requests while ForwardLogs
+	// also sends them to the client; they bypass log.Logger's writer then.
+	// Defaults to stderr.
+	LogOutput io.Writer
+}
+
+func NewMCPServer(store *MemoryStore, stats *UsageStats, opts *MCPServerOptions) *MCPServer {
 	s := &MCPServer{
-		store: store,
+		store:    store,
+		graph:    NewGraphStore(store),
+		stats:    stats,
+		projects: make(map[*mcp.ServerSession]*projectLookup),
+	}
+	if opts != nil {
+		s.opts = *opts
 	}
 
-	server := mcp.NewServer(&mcp.Implementation{Name: "memory-server"}, nil)
+	server := mcp.NewServer(&mcp.Implementation{Name: "memory-server"}, &mcp.ServerOptions{
+		Instructions:      serverInstructions,
+		CompletionHandler: s.complete,
+		InitializedHandler: func(ctx context.Context, req *mcp.InitializedRequest) {
+			// Read the client's roots right away rather than on first use.
+			go s.projectFor(context.WithoutCancel(ctx), req.Session)
+		},
+		RootsListChangedHandler: func(ctx context.Context, req *mcp.RootsListChangedRequest) {
+			s.forgetRoots(req.Session)
+		},
+	})
+	server.AddReceivingMiddleware(argumentErrorsAsToolErrors, s.withSessionLogger)
 
 	type addMemoryArgs struct {
-		Content    string   `json:"content" jsonschema:"the content of the memory document"`
-		Tags       []string `json:"tags,omitempty" jsonschema:"Tags for the document"`
-		Favorite   bool     `json:"favorite,omitempty" jsonschema:"Mark as favorite document"`
-		Properties map[string]string `json:"properties,omitempty" jsonschema:"Additional key-value properties"`
+		Content      string            `json:"content" jsonschema:"the content of the memory document"`
+		Tags         []string          `json:"tags,omitempty" jsonschema:"Tags for the document"`
+		Favorite     bool              `json:"favorite,omitempty" jsonschema:"Mark as favorite document"`
+		Properties   map[string]string `json:"properties,omitempty" jsonschema:"Additional key-value properties"`
+		SourceFile   string            `json:"source_file,omitempty" jsonschema:"File the memory is about, relative to the repository root"`
+		SourceRepo   string            `json:"source_repo,omitempty" jsonschema:"Repository the memory comes from"`
+		SourceCommit string            `json:"source_commit,omitempty" jsonschema:"Commit the memory refers to"`
+		Suggest      bool              `json:"suggest,omitempty" jsonschema:"Add suggested tags and a one-line title, using the client's model if it supports sampling"`
 	}
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "add_memory",
+		Title:       "Add memory",
 		Description: "Add a new memory document to the store",
+		InputSchema: inputSchema[addMemoryArgs](func(props map[string]*jsonschema.Schema) {
+			props["content"].MinLength = jsonschema.Ptr(1)
+			props["content"].Pattern = `\S`
+			props["tags"].Items.MinLength = jsonschema.Ptr(1)
+			props["tags"].UniqueItems = true
+		}),
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Add memory",
+			DestructiveHint: jsonschema.Ptr(false),
+			OpenWorldHint:   jsonschema.Ptr(false),
+		},
 	}, func(ctx context.Context, req *mcp.CallToolRequest, args addMemoryArgs) (*mcp.CallToolResult, any, error) {
+		if strings.TrimSpace(args.Content) == "" {
+			return toolError("content must not be empty: pass the text of the memory to store")
+		}
+		if msg := checkMemoryFields(args.Tags, args.Properties); msg != "" {
+			return toolError("%s", msg)
+		}
 		doc := Document{
 			ID:         uuid.New().String(),
 			Content:    args.Content,
 			CreatedAt:  time.Now(),
 			Tags:       args.Tags,
 			Favorite:   args.Favorite,
-			Properties: args.Properties,
+			Properties: s.scopeProperties(ctx, req.Session, args.Properties),
+			Provenance: sessionProvenance(req.Session),
+		}
+		doc.Provenance.SourceFile = args.SourceFile
+		doc.Provenance.SourceRepo = args.SourceRepo
+		doc.Provenance.SourceCommit = args.SourceCommit
+
+		var suggested suggestion
+		if args.Suggest {
+			suggested = s.suggest(ctx, req.Session, args.Content)
+			doc.Tags = mergeTags(doc.Tags, suggested.Tags)
+			if suggested.Title != "" && doc.Properties[TitleProperty] == "" {
+				props := make(map[string]string, len(doc.Properties)+1)
+				for k, v := range doc.Properties {
+					props[k] = v
+				}
+				props[TitleProperty] = suggested.Title
+				doc.Properties = props
+			}
 		}
+
 		if err := s.store.AddDocument(doc); err != nil {
 			return nil, nil, fmt.Errorf("failed to add document: %w", err)
 		}
+		s.stats.Record(OpAddDocument, ChannelMCP)
+
+		text := fmt.Sprintf("Memory added successfully with ID: %s", doc.ID)
+		if args.Suggest {
+			text += fmt.Sprintf("\nTitle: %s\nTags: %s\n(suggested by %s)", doc.Properties[TitleProperty], strings.Join(doc.Tags, ", "), suggested.Source)
+		}
 		return &mcp.CallToolResult{
 			Content: []mcp.Content{
-				&mcp.TextContent{Text: fmt.Sprintf("Memory added successfully with ID: %s", doc.ID)},
+				&mcp.TextContent{Text: text},
 			},
 		}, nil, nil
 	})
 
 	type searchMemoriesArgs struct {
-		Query     string  `json:"query" jsonschema:"Search query"`
-		Limit     int     `json:"limit,omitempty" jsonschema:"Maximum number of results"`
-		Threshold float32 `json:"threshold,omitempty" jsonschema:"Similarity threshold (0.0-1.0)"`
+		Query      string  `json:"query" jsonschema:"Search query"`
+		Limit      int     `json:"limit,omitempty" jsonschema:"Maximum number of results (1-100, default 10)"`
+		Threshold  float32 `json:"threshold,omitempty" jsonschema:"Similarity threshold (0.0-1.0, default 0.1)"`
+		Tag        string  `json:"tag,omitempty" jsonschema:"Only return memories with this tag"`
+		Namespace  string  `json:"namespace,omitempty" jsonschema:"Only return memories in this namespace"`
+		Client     string  `json:"client,omitempty" jsonschema:"Only return memories created by this MCP client, or \"web\""`
+		SourceRepo string  `json:"source_repo,omitempty" jsonschema:"Only return memories from this repository"`
+		SourceFile string  `json:"source_file,omitempty" jsonschema:"Only return memories about this file"`
 	}
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "search_memories",
+		Title:       "Search memories",
 		Description: "Search for memory documents based on query",
+		InputSchema: inputSchema[searchMemoriesArgs](func(props map[string]*jsonschema.Schema) {
+			props["query"].MinLength = jsonschema.Ptr(1)
+			props["query"].Pattern = `\S`
+			props["limit"].Minimum = jsonschema.Ptr(1.0)
+			props["limit"].Maximum = jsonschema.Ptr(float64(maxSearchLimit))
+			props["limit"].Default = json.RawMessage(strconv.Itoa(defaultSearchLimit))
+			props["threshold"].Minimum = jsonschema.Ptr(0.0)
+			props["threshold"].Maximum = jsonschema.Ptr(1.0)
+			props["threshold"].Default = json.RawMessage(strconv.FormatFloat(defaultSearchThreshold, 'f', -1, 32))
+		}),
+		Annotations: &mcp.ToolAnnotations{
+			Title:         "Search memories",
+			ReadOnlyHint:  true,
+			OpenWorldHint: jsonschema.Ptr(false),
+		},
 	}, func(ctx context.Context, req *mcp.CallToolRequest, args searchMemoriesArgs) (*mcp.CallToolResult, any, error) {
-		if args.Limit == 0 {
-			args.Limit = 10
+		// Omitted limit and threshold are filled in from the schema defaults,
+		// so an explicit threshold of 0 is passed through unchanged.
+		if strings.TrimSpace(args.Query) == "" {
+			return toolError("query must not be empty: describe what you are looking for")
 		}
-		if args.Threshold == 0 {
-			args.Threshold = 0.1
+		if args.Limit < 1 || args.Limit > maxSearchLimit {
+			return toolError("limit must be between 1 and %d, got %d", maxSearchLimit, args.Limit)
+		}
+		if args.Threshold < 0 || args.Threshold > 1 {
+			return toolError("threshold must be between 0.0 and 1.0, got %g: lower it to get more results", args.Threshold)
+		}
+		s.stats.Record(OpSearch, ChannelMCP)
+		filter := DocumentFilter{
+			Tag: args.Tag,
+			Provenance: Provenance{
+				Client:     args.Client,
+				SourceRepo: args.SourceRepo,
+				SourceFile: args.SourceFile,
+			},
+		}
+		if args.Namespace != "" {
+			filter.Properties = map[string]string{NamespaceProperty: args.Namespace}
+		}
+		s.scopeFilter(ctx, req.Session, &filter)
+		docs, err := s.store.SearchDocuments(args.Query, args.Limit, args.Threshold, filter)
+		if err != nil {
+			return nil, nil, fmt.Errorf("search failed: %w", err)
+		}
+		var results []string
+		for i, doc := range docs {
+			tags := strings.Join(doc.Tags, ", ")
+			favorite := ""
+			if doc.Favorite {
+				favorite = " ⭐"
+			}
+			result := fmt.Sprintf("%d. [%s]%s (Score: %.2f)\nContent: %s\nTags: %s\nCreated: %s\n",
+				i+1, doc.ID, favorite, doc.Score, doc.Content, tags, doc.CreatedAt.Format("2006-01-02 15:04:05"))
+			if source := doc.Provenance.String(); source != "" {
+				result += fmt.Sprintf("Source: %s\n", source)
+			}
+			results = append(results, result)
 		}
-		docs, err := s.store.SearchDocuments(args.Query, args.Limit, args.Threshold)
-				if err != nil {
-					return nil, nil, fmt.Errorf("search failed: %w", err)
-				}
-				var results []string
-				for i, doc := range docs {
-					tags := strings.Join(doc.Tags, ", ")
-					favorite := ""
-					if doc.Favorite {
-						favorite = " ⭐"
-					}
-					result := fmt.Sprintf("%d. [%s]%s (Score: %.2f)\nContent: %s\nTags: %s\nCreated: %s\n",
-						i+1, doc.ID, favorite, doc.Score, doc.Content, tags, doc.CreatedAt.Format("2006-01-02 15:04:05"))
-					results = append(results, result)
-				}
 		responseText := fmt.Sprintf("Found %d memories:\n\n%s", len(docs), strings.Join(results, "\n"))
 
 		return &mcp.CallToolResult{
@@ -92,8 +252,15 @@ func NewMCPServer(store *MemoryStore) *MCPServer {
 	type listMemoriesArgs struct{}
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "list_memories",
+		Title:       "List memories",
 		Description: "List all memory documents",
+		Annotations: &mcp.ToolAnnotations{
+			Title:         "List memories",
+			ReadOnlyHint:  true,
+			OpenWorldHint: jsonschema.Ptr(false),
+		},
 	}, func(ctx context.Context, req *mcp.CallToolRequest, args listMemoriesArgs) (*mcp.CallToolResult, any, error) {
+		s.stats.Record(OpGetAllDocuments, ChannelMCP)
 		docs, err := s.store.ListDocuments()
 		if err != nil {
 			return nil, nil, fmt.Errorf("list failed: %w", err)
@@ -108,6 +275,9 @@ func NewMCPServer(store *MemoryStore) *MCPServer {
 			}
 			result := fmt.Sprintf("%d. [%s]%s\nContent: %s\nTags: %s\nCreated: %s\n",
 				i+1, doc.ID, favorite, doc.Content, tags, doc.CreatedAt.Format("2006-01-02 15:04:05"))
+			if source := doc.Provenance.String(); source != "" {
+				result += fmt.Sprintf("Source: %s\n", source)
+			}
 			results = append(results, result)
 		}
 		responseText := fmt.Sprintf("Total %d memories:\n\n%s", len(docs), strings.Join(results, "\n"))
@@ -124,11 +294,46 @@ func NewMCPServer(store *MemoryStore) *MCPServer {
 	}
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "delete_memory",
+		Title:       "Delete memory",
 		Description: "Delete a memory document by ID",
+		InputSchema: inputSchema[deleteMemoryArgs](func(props map[string]*jsonschema.Schema) {
+			props["id"].MinLength = jsonschema.Ptr(1)
+		}),
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Delete memory",
+			DestructiveHint: jsonschema.Ptr(true),
+			IdempotentHint:  true,
+			OpenWorldHint:   jsonschema.Ptr(false),
+		},
 	}, func(ctx context.Context, req *mcp.CallToolRequest, args deleteMemoryArgs) (*mcp.CallToolResult, any, error) {
+		if strings.TrimSpace(args.ID) == "" {
+			return toolError("id must not be empty: use search_memories or list_memories to find the ID")
+		}
+		doc, err := s.store.GetDocument(args.ID)
+		if errors.Is(err, ErrDocumentNotFound) {
+			return toolError("no memory with ID %s: use search_memories or list_memories to find the ID", args.ID)
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("delete failed: %w", err)
+		}
+
+		switch s.confirmDestructive(ctx, req.Session, "delete this memory", []Document{doc}) {
+		case declined:
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("The user did not confirm deleting memory %s; it was kept", args.ID)},
+				},
+			}, nil, nil
+		case refused:
+			return toolError("deleting memory %s requires user confirmation, which this client does not support; ask the user to delete it from the web dashboard", args.ID)
+		}
+
 		if err := s.store.DeleteDocument(args.ID); err != nil {
+			if errors.Is(err, ErrDocumentNotFound) {
+				return toolError("no memory with ID %s: use search_memories or list_memories to find the ID", args.ID)
+			}
 			return nil, nil, fmt.Errorf("delete failed: %w", err)
 		}
+		s.stats.Record(OpDeleteDocument, ChannelMCP)
 		return &mcp.CallToolResult{
 			Content: []mcp.Content{
 				&mcp.TextContent{Text: fmt.Sprintf("Memory with ID %s deleted successfully", args.ID)},
@@ -136,14 +341,173 @@ func NewMCPServer(store *MemoryStore) *MCPServer {
 		}, nil, nil
 	})
 
+	s.registerContextTool(server)
+	s.registerBatchTools(server)
+	s.registerPrompts(server)
+	if s.opts.KnowledgeGraph {
+		s.registerGraphTools(server)
+	}
+
 	s.server = server
 	return s
 }
 
 func (s *MCPServer) Start() error {
-	return s.server.Run(context.Background(), &mcp.StdioTransport{})
+	return s.Run(context.Background())
+}
+
+// Run serves MCP over stdio until the client disconnects or ctx is cancelled.
+func (s *MCPServer) Run(ctx context.Context) error {
+	return s.server.Run(ctx, &mcp.StdioTransport{})
+}
+
+// StartHTTP serves MCP over the streamable HTTP transport on addr. Each client
+// gets its own session (tracked via the Mcp-Session-Id header) and responses
+// are streamed as server-sent events. An addr without a host, such as ":3000",
+// only listens on the loopback interface.
+func (s *MCPServer) StartHTTP(addr string) error {
+	return s.RunHTTP(context.Background(), addr)
+}
+
+// RunHTTP is like StartHTTP but shuts the listener down gracefully once ctx
+// is cancelled. Requests run in ctx, which ends the event streams that clients
+// keep open for server messages; shutdown would otherwise wait for them until
+// it times out.
+func (s *MCPServer) RunHTTP(ctx context.Context, addr string) error {
+	addr = localAddr(addr)
+	log.Info().Str("addr", addr).Bool("auth", s.opts.Tokens != nil).Msg("Starting MCP streamable HTTP server")
+	return serveHTTP(ctx, &http.Server{
+		Addr:        addr,
+		Handler:     s.HTTPHandler(),
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	})
+}
+
+// HTTPHandler returns an http.Handler for the streamable HTTP transport, so
+// that it can be mounted on an existing mux. It validates the Origin and Host
+// headers of every request, as the transport requires to prevent DNS
+// rebinding, and checks bearer tokens if MCPServerOptions.Tokens is set.
+func (s *MCPServer) HTTPHandler() http.Handler {
+	var handler http.Handler = mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server {
+		return s.server
+	}, nil)
+	if s.opts.Tokens != nil {
+		handler = s.opts.Tokens.RequireToken(handler)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := checkRequestOrigin(r, true); err != nil {
+			log.Warn().Err(err).Str("remote", r.RemoteAddr).Msg("Refused cross-site MCP request")
+			http.Error(w, "Forbidden: "+err.Error(), http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
 }
 
 func (s *MCPServer) Server() *mcp.Server {
 	return s.server
 }
+
+// sessionProvenance identifies the MCP client behind session.
+func sessionProvenance(session *mcp.ServerSession) Provenance {
+	var p Provenance
+	if session == nil {
+		return p
+	}
+	p.SessionID = session.ID()
+	if params := session.InitializeParams(); params != nil && params.ClientInfo != nil {
+		p.Client = params.ClientInfo.Name
+		p.ClientVersion = params.ClientInfo.Version
+	}
+	return p
+}
+
+// checkMemoryFields returns why add_memory and add_memories refuse the tags
+// or property keys of a new memory, or "" if they are valid.
+func checkMemoryFields(tags []string, properties map[string]string) string {
+	for _, tag := range tags {
+		if strings.TrimSpace(tag) == "" {
+			return "tags must not contain empty values: remove the empty tag or give it a name"
+		}
+		if strings.Contains(tag, ",") {
+			return fmt.Sprintf("tag %q must not contain a comma: pass each tag as a separate array element", tag)
+		}
+	}
+	for key := range properties {
+		if strings.TrimSpace(key) == "" {
+			return "property keys must not be empty"
+		}
+	}
+	return ""
+}
+
+// toolError reports a user-level failure (bad arguments, unknown ID) as a tool
+// result with IsError set, so the model sees the message and can correct the
+// call instead of the client treating it as a protocol error.
+func toolError(format string, args ...any) (*mcp.CallToolResult, any, error) {
+	return &mcp.CallToolResult{
+		IsError: true,
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: fmt.Sprintf(format, args...)},
+		},
+	}, nil, nil
+}
+
+// inputSchema infers the tool input schema from T and lets constrain add the
+// validation keywords (bounds, defaults, patterns) that struct tags cannot
+// express.
+func inputSchema[T any](constrain func(props map[string]*jsonschema.Schema)) *jsonschema.Schema {
+	schema, err := jsonschema.For[T](nil)
+	if err != nil {
+		panic(fmt.Sprintf("inferring input schema: %v", err))
+	}
+	constrain(schema.Properties)
+	return schema
+}
+
+// errInvalidParams is the SDK's jsonrpc2.ErrInvalidParams, which it wraps
+// when tool arguments fail the input schema or cannot be decoded. The SDK
+// exports neither the sentinel nor its error type, so an equal error is
+// obtained by decoding it from the wire; the SDK's errors match each other
+// by code with errors.Is.
+var errInvalidParams = func() error {
+	msg, err := jsonrpc.DecodeMessage([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32602,"message":"invalid params"}}`))
+	if err != nil {
+		panic(fmt.Sprintf("decoding invalid params error: %v", err))
+	}
+	return msg.(*jsonrpc.Response).Error
+}()
+
+// isInvalidParams reports whether err wraps the SDK's ErrInvalidParams.
+// Unknown tools carry the same code with a message of their own and remain
+// protocol errors.
+func isInvalidParams(err error) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if err.Error() == errInvalidParams.Error() && errors.Is(err, errInvalidParams) {
+			return true
+		}
+	}
+	return false
+}
+
+// argumentErrorsAsToolErrors turns schema validation failures of tool
+// arguments, which the SDK reports as JSON-RPC invalid-params errors, into
+// IsError tool results so that the model can read the message and retry.
+func argumentErrorsAsToolErrors(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		result, err := next(ctx, method, req)
+		if err == nil || method != "tools/call" || !isInvalidParams(err) {
+			return result, err
+		}
+		params, ok := req.GetParams().(*mcp.CallToolParamsRaw)
+		if !ok {
+			return result, err
+		}
+		msg := err.Error()
+		if i := strings.Index(msg, "validating /properties/"); i >= 0 {
+			msg = strings.TrimPrefix(msg[i:], "validating /properties/")
+		}
+		res, _, _ := toolError("invalid arguments for %s: %s", params.Name, msg)
+		return res, nil
+	}
+}
@@ -0,0 +1,295 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rs/zerolog/log"
+)
+
+// maxMessageSize bounds a single newline-delimited JSON-RPC message.
+const maxMessageSize = 64 * 1024 * 1024
+
+// SocketTransport connects an MCP client to a memory server listening on a
+// Unix domain socket (see MCPServer.RunSocket). Messages are newline-delimited
+// JSON-RPC, as with mcp.StdioTransport.
+type SocketTransport struct {
+	Path string
+}
+
+func (t *SocketTransport) Connect(ctx context.Context) (mcp.Connection, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", t.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", t.Path, err)
+	}
+	return newLineConn(conn), nil
+}
+
+// connTransport serves an already accepted connection.
+type connTransport struct {
+	conn net.Conn
+}
+
+func (t *connTransport) Connect(context.Context) (mcp.Connection, error) {
+	return newLineConn(t.conn), nil
+}
+
+// lineConn is an mcp.Connection exchanging newline-delimited JSON-RPC
+// messages over a net.Conn. Batches are not supported; MCP no longer uses
+// them.
+type lineConn struct {
+	conn      net.Conn
+	sessionID string
+
+	writeMu sync.Mutex
+
+	incoming  chan []byte
+	readErr   error // set before incoming is closed
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newLineConn(conn net.Conn) *lineConn {
+	c := &lineConn{
+		conn:      conn,
+		sessionID: uuid.New().String(),
+		incoming:  make(chan []byte),
+		closed:    make(chan struct{}),
+	}
+	go c.readLoop()
+	return c
+}
+
+// readLoop reads messages in the background so that Read can honour context
+// cancellation.
+func (c *lineConn) readLoop() {
+	defer close(c.incoming)
+	scanner := bufio.NewScanner(c.conn)
+	scanner.Buffer(nil, maxMessageSize)
+	for scanner.Scan() {
+		line := append([]byte(nil), scanner.Bytes()...)
+		if len(line) == 0 {
+			continue
+		}
+		select {
+		case c.incoming <- line:
+		case <-c.closed:
+			return
+		}
+	}
+	c.readErr = scanner.Err()
+	if c.readErr == nil {
+		c.readErr = io.EOF
+	}
+}
+
+func (c *lineConn) Read(ctx context.Context) (jsonrpc.Message, error) {
+	select {
+	case line, ok := <-c.incoming:
+		if !ok {
+			return nil, c.readErr
+		}
+		return jsonrpc.DecodeMessage(line)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.closed:
+		return nil, io.EOF
+	}
+}
+
+func (c *lineConn) Write(ctx context.Context, msg jsonrpc.Message) error {
+	data, err := jsonrpc.EncodeMessage(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err = c.conn.Write(append(data, '\n'))
+	return err
+}
+
+func (c *lineConn) Close() error {
+	err := net.ErrClosed
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		err = c.conn.Close()
+	})
+	return err
+}
+
+func (c *lineConn) SessionID() string {
+	return c.sessionID
+}
+
+// StartSocket serves MCP on the Unix domain socket at path.
+func (s *MCPServer) StartSocket(path string) error {
+	return s.RunSocket(context.Background(), path)
+}
+
+// RunSocket serves MCP on the Unix domain socket at path until ctx is
+// cancelled. Every connection gets its own session, so an IDE, a terminal
+// agent and scripts can share one memory process without a TCP port. The
+// socket is only accessible to the current user and is removed on return.
+func (s *MCPServer) RunSocket(ctx context.Context, path string) error {
+	if err := removeStaleSocket(path); err != nil {
+		return err
+	}
+	listener, err := listenPrivate(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+	log.Info().Str("path", path).Msg("Starting MCP Unix socket server")
+
+	var (
+		mu       sync.Mutex
+		sessions = make(map[*mcp.ServerSession]bool)
+		wg       sync.WaitGroup
+	)
+	stop := context.AfterFunc(ctx, func() {
+		listener.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for session := range sessions {
+			session.Close()
+		}
+	})
+	defer stop()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			wg.Wait()
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to accept connection: %w", err)
+		}
+
+		session, err := s.server.Connect(ctx, &connTransport{conn: conn}, nil)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to start MCP session")
+			conn.Close()
+			continue
+		}
+		// Register the session under the lock, so that it is either closed
+		// by stop or, if ctx was cancelled in the meantime, here.
+		mu.Lock()
+		if ctx.Err() != nil {
+			mu.Unlock()
+			session.Close()
+			continue
+		}
+		sessions[session] = true
+		wg.Add(1)
+		mu.Unlock()
+		log.Info().Str("session", session.ID()).Msg("MCP socket client connected")
+
+		go func() {
+			defer wg.Done()
+			err := session.Wait()
+			mu.Lock()
+			delete(sessions, session)
+			mu.Unlock()
+			log.Info().Err(err).Str("session", session.ID()).Msg("MCP socket client disconnected")
+		}()
+	}
+}
+
+// listenPrivate listens on a Unix socket at path that only the current user
+// can connect to. The socket is created in a new directory that only the user
+// can enter, restricted there and then moved to path, so it is never
+// accessible to others, whatever the umask.
+func listenPrivate(ctx context.Context, path string) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".sock")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, "s")
+	var lc net.ListenConfig
+	listener, err := lc.Listen(ctx, "unix", tmp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	// The socket file is removed by RunSocket under its final name.
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, 0o600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to restrict access to %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	return listener, nil
+}
+
+// removeStaleSocket removes a socket file left behind by a process that is no
+// longer running. It fails if another server is still listening on path.
+func removeStaleSocket(path string) error {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("another server is already listening on %s", path)
+	}
+	return os.Remove(path)
+}
+
+// BridgeStdio connects stdin and stdout to the memory server listening on the
+// Unix socket at path, so that clients that can only launch stdio servers can
+// attach to a shared process.
+func BridgeStdio(ctx context.Context, path string) error {
+	return Bridge(ctx, path, os.Stdin, os.Stdout)
+}
+
+// Bridge copies in to the socket at path and the server's replies to out
+// until the server closes the connection or ctx is cancelled. When in is
+// exhausted, the sending half of the connection is closed and Bridge waits
+// for the remaining replies.
+func Bridge(ctx context.Context, path string, in io.Reader, out io.Writer) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", path)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", path, err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	go func() {
+		if _, err := io.Copy(conn, in); err != nil {
+			log.Debug().Err(err).Msg("Bridge input closed")
+		}
+		if uc, ok := conn.(*net.UnixConn); ok {
+			uc.CloseWrite()
+		}
+	}()
+
+	_, err = io.Copy(out, conn)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
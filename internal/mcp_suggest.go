@@ -0,0 +1,230 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const (
+	maxSuggestedTags = 5
+	maxTitleRunes    = 80
+	// samplingTimeout is generous because clients may ask the user to
+	// approve the request before sampling.
+	samplingTimeout   = 60 * time.Second
+	samplingMaxTokens = 200
+	// maxPromptTags bounds how many existing tags are offered to the model
+	// for reuse.
+	maxPromptTags = 100
+)
+
+const suggestionSystemPrompt = `You label notes for a memory store. Reply with only a JSON object of the form {"title": "...", "tags": ["...", "..."]}: a one-line title of at most 80 characters and up to 5 short lowercase tags. Prefer existing tags where they fit.`
+
+// suggestion is a title and tags proposed for a new memory.
+type suggestion struct {
+	Title string   `json:"title"`
+	Tags  []string `json:"tags"`
+	// Source says where the suggestion came from, for the tool result.
+	Source string `json:"-"`
+}
+
+// suggest proposes a title and tags for content. It asks the client's model
+// through sampling when the client supports it, and falls back to local
+// heuristics otherwise or if sampling fails.
+func (s *MCPServer) suggest(ctx context.Context, session *mcp.ServerSession, content string) suggestion {
+	existing, err := s.store.Tags()
+	if err != nil {
+		loggerFor(ctx).Warn().Err(err).Msg("Failed to list tags for suggestions")
+	}
+
+	if supportsSampling(session) {
+		sug, err := sampleSuggestion(ctx, session, content, existing)
+		if err == nil {
+			sug.Source = "the client's model"
+			return sug
+		}
+		loggerFor(ctx).Info().Err(err).Msg("Sampling failed, suggesting tags locally")
+	}
+
+	sug := heuristicSuggestion(content, existing)
+	sug.Source = "local heuristics"
+	return sug
+}
+
+func supportsSampling(session *mcp.ServerSession) bool {
+	if session == nil {
+		return false
+	}
+	params := session.InitializeParams()
+	return params != nil && params.Capabilities != nil && params.Capabilities.Sampling != nil
+}
+
+func sampleSuggestion(ctx context.Context, session *mcp.ServerSession, content string, existing []string) (suggestion, error) {
+	ctx, cancel := context.WithTimeout(ctx, samplingTimeout)
+	defer cancel()
+
+	if len(existing) > maxPromptTags {
+		existing = existing[:maxPromptTags]
+	}
+	prompt := "Existing tags: " + strings.Join(existing, ", ") + "\n\nNote:\n" + content
+	if len(existing) == 0 {
+		prompt = "Note:\n" + content
+	}
+	res, err := session.CreateMessage(ctx, &mcp.CreateMessageParams{
+		SystemPrompt: suggestionSystemPrompt,
+		Messages: []*mcp.SamplingMessage{
+			{Role: "user", Content: &mcp.TextContent{Text: prompt}},
+		},
+		MaxTokens:   samplingMaxTokens,
+		Temperature: 0,
+		ModelPreferences: &mcp.ModelPreferences{
+			SpeedPriority: 1,
+			CostPriority:  1,
+		},
+	})
+	if err != nil {
+		return suggestion{}, fmt.Errorf("sampling failed: %w", err)
+	}
+	text, ok := res.Content.(*mcp.TextContent)
+	if !ok {
+		return suggestion{}, fmt.Errorf("sampling returned %T, want text", res.Content)
+	}
+
+	// Models like to wrap JSON in prose or code fences.
+	start, end := strings.Index(text.Text, "{"), strings.LastIndex(text.Text, "}")
+	if start < 0 || end < start {
+		return suggestion{}, errors.New("sampling reply contains no JSON object")
+	}
+	var sug suggestion
+	if err := json.Unmarshal([]byte(text.Text[start:end+1]), &sug); err != nil {
+		return suggestion{}, fmt.Errorf("invalid sampling reply: %w", err)
+	}
+	sug.Title = cleanTitle(sug.Title)
+	sug.Tags = normalizeTags(sug.Tags)
+	if sug.Title == "" && len(sug.Tags) == 0 {
+		return suggestion{}, errors.New("sampling reply is empty")
+	}
+	return sug, nil
+}
+
+// heuristicSuggestion titles content with its first sentence and tags it with
+// existing tags it mentions, then with its most frequent significant words.
+func heuristicSuggestion(content string, existing []string) suggestion {
+	sug := suggestion{Title: cleanTitle(firstSentence(content))}
+
+	counts := make(map[string]int)
+	var order []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(content), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_'
+	}) {
+		word = strings.Trim(word, "-_")
+		if counts[word] == 0 {
+			order = append(order, word)
+		}
+		counts[word]++
+	}
+
+	var tags []string
+	for _, tag := range existing {
+		if counts[strings.ToLower(tag)] > 0 {
+			tags = append(tags, tag)
+		}
+	}
+
+	var keywords []string
+	for _, word := range order {
+		if counts[word] >= 2 && len([]rune(word)) >= 4 && !stopWords[word] && !isNumber(word) {
+			keywords = append(keywords, word)
+		}
+	}
+	sort.SliceStable(keywords, func(i, j int) bool { return counts[keywords[i]] > counts[keywords[j]] })
+	sug.Tags = normalizeTags(append(tags, keywords...))
+	return sug
+}
+
+// firstSentence returns the first non-empty line of content, without Markdown
+// heading or list markers, cut after its first sentence.
+func firstSentence(content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimLeft(strings.TrimSpace(line), "#>*- ")
+		if line == "" {
+			continue
+		}
+		if i := strings.Index(line, ". "); i >= 0 {
+			line = line[:i+1]
+		}
+		return line
+	}
+	return ""
+}
+
+func cleanTitle(title string) string {
+	title = strings.Join(strings.Fields(title), " ")
+	return truncateRunes(title, maxTitleRunes)
+}
+
+// normalizeTags trims tags, drops empty, comma-containing and duplicate ones
+// (ignoring case), and keeps at most maxSuggestedTags.
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool)
+	result := []string{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || strings.Contains(tag, ",") || seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		result = append(result, tag)
+		if len(result) == maxSuggestedTags {
+			break
+		}
+	}
+	return result
+}
+
+// mergeTags appends the suggested tags that are not in tags yet.
+func mergeTags(tags, suggested []string) []string {
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		seen[strings.ToLower(tag)] = true
+	}
+	for _, tag := range suggested {
+		if !seen[strings.ToLower(tag)] {
+			seen[strings.ToLower(tag)] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func isNumber(word string) bool {
+	for _, r := range word {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+var stopWords = map[string]bool{
+	"about": true, "after": true, "again": true, "also": true, "because": true,
+	"been": true, "before": true, "being": true, "between": true, "both": true,
+	"could": true, "does": true, "doing": true, "down": true, "during": true,
+	"each": true, "from": true, "further": true, "have": true, "having": true,
+	"here": true, "into": true, "just": true, "like": true, "more": true,
+	"most": true, "must": true, "need": true, "only": true, "other": true,
+	"over": true, "same": true, "should": true, "some": true, "such": true,
+	"than": true, "that": true, "their": true, "them": true, "then": true,
+	"there": true, "these": true, "they": true, "this": true, "those": true,
+	"through": true, "under": true, "until": true, "used": true, "uses": true,
+	"using": true, "very": true, "want": true, "were": true, "what": true,
+	"when": true, "where": true, "which": true, "while": true, "will": true,
+	"with": true, "would": true, "your": true,
+}
@@ -2,8 +2,11 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/philippgille/chromem-go"
@@ -17,11 +20,182 @@ type Document struct {
 	Properties map[string]string `json:"properties"`
 	Favorite   bool              `json:"favorite"`
 	CreatedAt  time.Time         `json:"created_at"`
+	Provenance Provenance        `json:"provenance"`
 	Score      float32           `json:"score,omitempty"`
 }
 
+// Provenance records who or what created a document.
+type Provenance struct {
+	// Client is the MCP client name, or "web" for the dashboard and REST API.
+	Client        string `json:"client,omitempty"`
+	ClientVersion string `json:"client_version,omitempty"`
+	SessionID     string `json:"session_id,omitempty"`
+	// Source* are optionally supplied by the agent.
+	SourceFile   string `json:"source_file,omitempty"`
+	SourceRepo   string `json:"source_repo,omitempty"`
+	SourceCommit string `json:"source_commit,omitempty"`
+}
+
+// WebClient is the Provenance.Client of documents created through the web
+// dashboard or REST API.
+const WebClient = "web"
+
+// provenanceKeys maps metadata keys to Provenance fields.
+func provenanceKeys(p *Provenance) map[string]*string {
+	return map[string]*string{
+		"client":         &p.Client,
+		"client_version": &p.ClientVersion,
+		"session_id":     &p.SessionID,
+		"source_file":    &p.SourceFile,
+		"source_repo":    &p.SourceRepo,
+		"source_commit":  &p.SourceCommit,
+	}
+}
+
+// String summarizes the provenance on one line, e.g.
+// "claude-code 1.2.0 · myrepo@abc123 · main.go".
+func (p Provenance) String() string {
+	var parts []string
+	if p.Client != "" {
+		parts = append(parts, strings.TrimSpace(p.Client+" "+p.ClientVersion))
+	}
+	if p.SourceRepo != "" {
+		repo := p.SourceRepo
+		if p.SourceCommit != "" {
+			repo += "@" + p.SourceCommit
+		}
+		parts = append(parts, repo)
+	} else if p.SourceCommit != "" {
+		parts = append(parts, p.SourceCommit)
+	}
+	if p.SourceFile != "" {
+		parts = append(parts, p.SourceFile)
+	}
+	return strings.Join(parts, " · ")
+}
+
+// ErrDocumentNotFound is returned when no document has the requested ID.
+var ErrDocumentNotFound = errors.New("document not found")
+
+// ErrDocumentExists is returned by CreateDocument when the ID is taken.
+var ErrDocumentExists = errors.New("document already exists")
+
+// ValidationError is returned when a document cannot be stored as given.
+type ValidationError struct {
+	Field  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Reason)
+}
+
+// validateDocument checks the fields that cannot round-trip through chromem's
+// metadata: tags are stored comma-separated, properties under their key.
+func validateDocument(doc Document) error {
+	if strings.TrimSpace(doc.Content) == "" {
+		return &ValidationError{Field: "content", Reason: "must not be empty"}
+	}
+	for _, tag := range doc.Tags {
+		if strings.TrimSpace(tag) == "" || strings.Contains(tag, ",") {
+			return &ValidationError{Field: "tags", Reason: fmt.Sprintf("%q must be non-empty and must not contain commas", tag)}
+		}
+	}
+	for key := range doc.Properties {
+		if key == "" {
+			return &ValidationError{Field: "properties", Reason: "keys must not be empty"}
+		}
+	}
+	return nil
+}
+
+// NamespaceProperty is the document property that groups memories into
+// namespaces, such as one per project.
+const NamespaceProperty = "namespace"
+
+// TitleProperty is the document property holding a memory's one-line title.
+const TitleProperty = "title"
+
+// DocumentFilter narrows search results. Zero-valued fields match everything.
+type DocumentFilter struct {
+	// Tag, when set, requires the document to carry this tag.
+	Tag string
+	// Properties requires each key to be present with exactly this value.
+	Properties map[string]string
+	// Provenance requires each non-empty field to match exactly.
+	Provenance Provenance
+	// Prefer does not exclude anything: documents whose properties match all
+	// of these values have their score boosted, so they rank first.
+	Prefer map[string]string
+}
+
+// Matches reports whether doc satisfies the filter.
+func (f DocumentFilter) Matches(doc Document) bool {
+	if f.Tag != "" {
+		found := false
+		for _, tag := range doc.Tags {
+			if tag == f.Tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for k, v := range f.Properties {
+		if doc.Properties[k] != v {
+			return false
+		}
+	}
+	docProvenance := provenanceKeys(&doc.Provenance)
+	for k, want := range provenanceKeys(&f.Provenance) {
+		if *want != "" && *docProvenance[k] != *want {
+			return false
+		}
+	}
+	return true
+}
+
+func (f DocumentFilter) isEmpty() bool {
+	return f.Tag == "" && len(f.Properties) == 0 && len(f.Prefer) == 0 && f.Provenance == Provenance{}
+}
+
+func (f DocumentFilter) preferred(doc Document) bool {
+	if len(f.Prefer) == 0 {
+		return false
+	}
+	for k, v := range f.Prefer {
+		if doc.Properties[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// preferredBoost is the score multiplier for documents matching
+// DocumentFilter.Prefer.
+const preferredBoost = 1.25
+
+// memoriesCollection is the chromem collection holding memories.
+const memoriesCollection = "memories"
+
 type MemoryStore struct {
-	db *chromem.DB
+	// mu serializes writes against reads so that a check-then-write such as
+	// CreateDocument is never interleaved when the MCP and web servers share
+	// a store. It is shared with graph, so that Flush waits for both.
+	mu   *sync.RWMutex
+	db   *chromem.DB
+	path string
+	// collection names the chromem collection holding the documents.
+	collection string
+	// graph stores the knowledge graph in a collection of its own, so that
+	// graph data never shows up among memories.
+	graph *MemoryStore
+	
+	// embed is the collection's embedding function, timed into latency.
+	embed   chromem.EmbeddingFunc
+	latency *LatencyMetrics
 }
 
 func NewMemoryStore(path string) (*MemoryStore, error) {
@@ -33,23 +207,89 @@ func NewMemoryStore(path string) (*MemoryStore, error) {
 	}
 	
 	// Create collection with custom embedding function
-	embedder := NewStatisticalEmbedder()
-	collection, err := db.GetOrCreateCollection("memories", nil, embedder)
+	latency := NewLatencyMetrics()
+	embedder := timedEmbedding(NewStatisticalEmbedder(), latency)
+	collection, err := db.GetOrCreateCollection(memoriesCollection, nil, embedder)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create collection: %w", err)
 	}
+	if _, err := db.GetOrCreateCollection(graphCollection, nil, embedder); err != nil {
+		return nil, fmt.Errorf("failed to create collection: %w", err)
+	}
 	
 	log.Info().Str("collection", collection.Name).Msg("Memory store initialized")
 	
-	return &MemoryStore{
-		db: db,
-	}, nil
+	ms := &MemoryStore{
+		mu:         &sync.RWMutex{},
+		db:         db,
+		path:       path,
+		collection: memoriesCollection,
+		embed:      embedder,
+		latency:    latency,
+	}
+	graph := *ms
+	graph.collection = graphCollection
+	ms.graph = &graph
+	return ms, nil
+}
+
+// Latency returns the latency histograms of embedding, querying and
+// persisting documents.
+func (ms *MemoryStore) Latency() *LatencyMetrics {
+	return ms.latency
+}
+
+// Path returns the directory of the persistent database.
+func (ms *MemoryStore) Path() string {
+	return ms.path
 }
 
 func (ms *MemoryStore) AddDocument(doc Document) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.addDocument(doc)
+}
+
+// CreateDocument validates doc and adds it, failing with ErrDocumentExists
+// instead of overwriting a document with the same ID.
+func (ms *MemoryStore) CreateDocument(doc Document) error {
+	if err := validateDocument(doc); err != nil {
+		return err
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, err := ms.getDocument(doc.ID); err == nil {
+		return fmt.Errorf("%w: %s", ErrDocumentExists, doc.ID)
+	} else if !errors.Is(err, ErrDocumentNotFound) {
+		return err
+	}
+	return ms.addDocument(doc)
+}
+
+// UpdateDocument replaces the document with the same ID, re-embedding its
+// content. chromem overwrites documents by ID, so the old version stays in
+// place until the new one has been embedded: if embedding fails, nothing is
+// lost.
+func (ms *MemoryStore) UpdateDocument(doc Document) error {
+	if err := validateDocument(doc); err != nil {
+		return err
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, err := ms.getDocument(doc.ID); err != nil {
+		return err
+	}
+	return ms.addDocument(doc)
+}
+
+func (ms *MemoryStore) addDocument(doc Document) error {
 	log.Info().Str("id", doc.ID).Msg("Adding document to memory store")
 	
-	collection := ms.db.GetCollection("memories", nil)
+	collection := ms.db.GetCollection(ms.collection, nil)
 	if collection == nil {
 		return fmt.Errorf("collection not found")
 	}
@@ -63,17 +303,31 @@ func (ms *MemoryStore) AddDocument(doc Document) error {
 		metadata["favorite"] = "false"
 	}
 	metadata["created_at"] = doc.CreatedAt.Format(time.RFC3339)
+	for k, v := range provenanceKeys(&doc.Provenance) {
+		if *v != "" {
+			metadata[k] = *v
+		}
+	}
 	
 	// Add properties to metadata
 	for k, v := range doc.Properties {
 		metadata["prop_"+k] = v
 	}
 	
-	err := collection.AddDocument(context.Background(), chromem.Document{
-		ID:       doc.ID,
-		Content:  doc.Content,
-		Metadata: metadata,
+	// Embed explicitly so that persisting can be timed on its own
+	embedding, err := ms.embed(context.Background(), doc.Content)
+	if err != nil {
+		return fmt.Errorf("failed to embed document: %w", err)
+	}
+	
+	start := time.Now()
+	err = collection.AddDocument(context.Background(), chromem.Document{
+		ID:        doc.ID,
+		Content:   doc.Content,
+		Metadata:  metadata,
+		Embedding: embedding,
 	})
+	ms.latency.Since(PhasePersist, start)
 	
 	if err != nil {
 		log.Error().Err(err).Str("id", doc.ID).Msg("Failed to add document")
@@ -84,10 +338,13 @@ func (ms *MemoryStore) AddDocument(doc Document) error {
 	return nil
 }
 
-func (ms *MemoryStore) SearchDocuments(query string, limit int, threshold float32) ([]Document, error) {
+func (ms *MemoryStore) SearchDocuments(query string, limit int, threshold float32, filter DocumentFilter) ([]Document, error) {
 	log.Info().Str("query", query).Int("limit", limit).Float32("threshold", threshold).Msg("Searching documents")
 	
-	collection := ms.db.GetCollection("memories", nil)
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	
+	collection := ms.db.GetCollection(ms.collection, nil)
 	if collection == nil {
 		return nil, fmt.Errorf("collection not found")
 	}
@@ -98,11 +355,18 @@ func (ms *MemoryStore) SearchDocuments(query string, limit int, threshold float3
 	}
 
 	nResults := limit
-	if limit > int(count) {
+	if limit > int(count) || !filter.isEmpty() {
+		// Filters are applied after ranking, so consider every document
 		nResults = int(count)
 	}
 
-	results, err := collection.Query(context.Background(), query, nResults, nil, nil)
+	embedding, err := ms.embed(context.Background(), query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+	start := time.Now()
+	results, err := collection.QueryEmbedding(context.Background(), embedding, nResults, nil, nil)
+	ms.latency.Since(PhaseQuery, start)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to search documents")
 		return nil, fmt.Errorf("failed to search documents: %w", err)
@@ -115,33 +379,10 @@ func (ms *MemoryStore) SearchDocuments(query string, limit int, threshold float3
 			continue
 		}
 		
-		doc := Document{
-			ID:        result.ID,
-			Content:   result.Content,
-			CreatedAt: time.Now(), // Default value
-			Score:     result.Similarity,
-		}
-		
-		// Parse metadata
-		if tagsStr, ok := result.Metadata["tags"]; ok && tagsStr != "" {
-			doc.Tags = strings.Split(tagsStr, ",")
-		}
-		if favoriteStr, ok := result.Metadata["favorite"]; ok {
-			doc.Favorite = favoriteStr == "true"
-		}
-		if createdAt, ok := result.Metadata["created_at"]; ok {
-			if t, err := time.Parse(time.RFC3339, createdAt); err == nil {
-				doc.CreatedAt = t
-			}
-		}
-		
-		// Parse properties
-		doc.Properties = make(map[string]string)
-		for k, v := range result.Metadata {
-			if strings.HasPrefix(k, "prop_") {
-				propKey := strings.TrimPrefix(k, "prop_")
-				doc.Properties[propKey] = v
-			}
+		doc := documentFromMetadata(result.ID, result.Content, result.Metadata)
+		doc.Score = result.Similarity
+		if !filter.Matches(doc) {
+			continue
 		}
 		
 		// Boost favorite documents
@@ -149,22 +390,47 @@ func (ms *MemoryStore) SearchDocuments(query string, limit int, threshold float3
 			result.Similarity *= 1.2 // Boost favorite documents
 		}
 		
+		if filter.preferred(doc) {
+			doc.Score *= preferredBoost
+		}
+		
 		documents = append(documents, doc)
 	}
 	
+	if len(filter.Prefer) > 0 {
+		sort.SliceStable(documents, func(i, j int) bool {
+			return documents[i].Score > documents[j].Score
+		})
+	}
+	if len(documents) > limit {
+		documents = documents[:limit]
+	}
+	
 	log.Info().Int("count", len(documents)).Msg("Search completed")
 	return documents, nil
 }
 
 func (ms *MemoryStore) DeleteDocument(id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.deleteDocument(id)
+}
+
+func (ms *MemoryStore) deleteDocument(id string) error {
 	log.Info().Str("id", id).Msg("Deleting document")
 	
-	collection := ms.db.GetCollection("memories", nil)
+	collection := ms.db.GetCollection(ms.collection, nil)
 	if collection == nil {
 		return fmt.Errorf("collection not found")
 	}
 	
-	err := collection.Delete(context.Background(), nil, map[string]string{"id": id})
+	if _, err := collection.GetByID(context.Background(), id); err != nil {
+		return fmt.Errorf("%w: %s", ErrDocumentNotFound, id)
+	}
+	
+	start := time.Now()
+	err := collection.Delete(context.Background(), nil, nil, id)
+	ms.latency.Since(PhasePersist, start)
 	if err != nil {
 		log.Error().Err(err).Str("id", id).Msg("Failed to delete document")
 		return fmt.Errorf("failed to delete document: %w", err)
@@ -174,63 +440,219 @@ func (ms *MemoryStore) DeleteDocument(id string) error {
 	return nil
 }
 
+// GetDocument returns the document with the given ID, or ErrDocumentNotFound.
+func (ms *MemoryStore) GetDocument(id string) (Document, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.getDocument(id)
+}
+
+func (ms *MemoryStore) getDocument(id string) (Document, error) {
+	collection := ms.db.GetCollection(ms.collection, nil)
+	if collection == nil {
+		return Document{}, fmt.Errorf("collection not found")
+	}
+	
+	result, err := collection.GetByID(context.Background(), id)
+	if err != nil {
+		return Document{}, fmt.Errorf("%w: %s", ErrDocumentNotFound, id)
+	}
+	
+	return documentFromMetadata(result.ID, result.Content, result.Metadata), nil
+}
+
+// Count returns the number of documents without loading them.
+func (ms *MemoryStore) Count() (int, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	
+	collection := ms.db.GetCollection(ms.collection, nil)
+	if collection == nil {
+		return 0, fmt.Errorf("collection not found")
+	}
+	return collection.Count(), nil
+}
+
 func (ms *MemoryStore) ListDocuments() ([]Document, error) {
 	log.Info().Msg("Listing all documents")
 	
-	collection := ms.db.GetCollection("memories", nil)
+	documents := []Document{}
+	err := ms.EachDocument(func(doc Document) bool {
+		documents = append(documents, doc)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	
+	log.Info().Int("count", len(documents)).Msg("Listed all documents")
+	return documents, nil
+}
+
+// EachDocument calls fn with every document, in no particular order, until
+// fn returns false. chromem has no cursor, so all documents are loaded at
+// once; only their conversion to Document happens one at a time. fn runs
+// with the store locked for reading and must not write to it.
+func (ms *MemoryStore) EachDocument(fn func(Document) bool) error {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	
+	collection := ms.db.GetCollection(ms.collection, nil)
 	if collection == nil {
-		return nil, fmt.Errorf("collection not found")
+		return fmt.Errorf("collection not found")
 	}
 	
 	count := collection.Count()
 	if count == 0 {
-		return []Document{}, nil
+		return nil
 	}
 
 	// Get all documents by querying with a single space and high limit
-	results, err := collection.Query(context.Background(), " ", int(count), nil, nil)
+	results, err := collection.Query(context.Background(), " ", count, nil, nil)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to list documents")
-		return nil, fmt.Errorf("failed to list documents: %w", err)
+		return fmt.Errorf("failed to list documents: %w", err)
 	}
 	
-	var documents []Document
 	for _, result := range results {
-		doc := Document{
-			ID:        result.ID,
-			Content:   result.Content,
-			CreatedAt: time.Now(),
+		if !fn(documentFromMetadata(result.ID, result.Content, result.Metadata)) {
+			break
 		}
-		
-		// Parse metadata (same as in SearchDocuments)
-		if tagsStr, ok := result.Metadata["tags"]; ok && tagsStr != "" {
-			doc.Tags = strings.Split(tagsStr, ",")
+	}
+	return nil
+}
+
+// Reindex recomputes the embedding of every document, calling progress after
+// each one. It returns the number of documents reindexed.
+func (ms *MemoryStore) Reindex(ctx context.Context, progress func(done, total int)) (int, error) {
+	log.Info().Msg("Reindexing all documents")
+	
+	docs, err := ms.ListDocuments()
+	if err != nil {
+		return 0, err
+	}
+	
+	for i, doc := range docs {
+		if err := ctx.Err(); err != nil {
+			return i, err
 		}
-		if favoriteStr, ok := result.Metadata["favorite"]; ok {
-			doc.Favorite = favoriteStr == "true"
+		if err := ms.UpdateDocument(doc); err != nil {
+			return i, err
 		}
-		if createdAt, ok := result.Metadata["created_at"]; ok {
-			if t, err := time.Parse(time.RFC3339, createdAt); err == nil {
-				doc.CreatedAt = t
-			}
+		progress(i+1, len(docs))
+	}
+	
+	log.Info().Int("count", len(docs)).Msg("Reindex completed")
+	return len(docs), nil
+}
+
+// Tags returns the distinct tags in use, sorted.
+func (ms *MemoryStore) Tags() ([]string, error) {
+	docs, err := ms.ListDocuments()
+	if err != nil {
+		return nil, err
+	}
+	
+	var values []string
+	for _, doc := range docs {
+		values = append(values, doc.Tags...)
+	}
+	return uniqueSorted(values), nil
+}
+
+// PropertyKeys returns the distinct property keys in use, sorted.
+func (ms *MemoryStore) PropertyKeys() ([]string, error) {
+	docs, err := ms.ListDocuments()
+	if err != nil {
+		return nil, err
+	}
+	
+	var keys []string
+	for _, doc := range docs {
+		for k := range doc.Properties {
+			keys = append(keys, k)
 		}
-		
-		doc.Properties = make(map[string]string)
-		for k, v := range result.Metadata {
-			if strings.HasPrefix(k, "prop_") {
-				propKey := strings.TrimPrefix(k, "prop_")
-				doc.Properties[propKey] = v
-			}
+	}
+	return uniqueSorted(keys), nil
+}
+
+// PropertyValues returns the distinct values stored under property key,
+// sorted.
+func (ms *MemoryStore) PropertyValues(key string) ([]string, error) {
+	docs, err := ms.ListDocuments()
+	if err != nil {
+		return nil, err
+	}
+	
+	var values []string
+	for _, doc := range docs {
+		if v, ok := doc.Properties[key]; ok && v != "" {
+			values = append(values, v)
 		}
-		
-		documents = append(documents, doc)
+	}
+	return uniqueSorted(values), nil
+}
+
+func uniqueSorted(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := []string{}
+	for _, v := range values {
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		unique = append(unique, v)
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+// documentFromMetadata rebuilds a Document from the chromem metadata written
+// by addDocument.
+func documentFromMetadata(id, content string, metadata map[string]string) Document {
+	doc := Document{
+		ID:        id,
+		Content:   content,
+		Tags:      []string{}, // Sent as [] rather than null when there are none
+		CreatedAt: time.Now(), // Default value
 	}
 	
-	log.Info().Int("count", len(documents)).Msg("Listed all documents")
-	return documents, nil
+	if tagsStr, ok := metadata["tags"]; ok && tagsStr != "" {
+		doc.Tags = strings.Split(tagsStr, ",")
+	}
+	if favoriteStr, ok := metadata["favorite"]; ok {
+		doc.Favorite = favoriteStr == "true"
+	}
+	if createdAt, ok := metadata["created_at"]; ok {
+		if t, err := time.Parse(time.RFC3339, createdAt); err == nil {
+			doc.CreatedAt = t
+		}
+	}
+	for k, v := range provenanceKeys(&doc.Provenance) {
+		*v = metadata[k]
+	}
+	
+	doc.Properties = make(map[string]string)
+	for k, v := range metadata {
+		if strings.HasPrefix(k, "prop_") {
+			propKey := strings.TrimPrefix(k, "prop_")
+			doc.Properties[propKey] = v
+		}
+	}
+	
+	return doc
+}
+
+// Flush waits for writes in progress to finish. chromem persists every write
+// before returning, so afterwards everything is on disk.
+func (ms *MemoryStore) Flush() {
+	ms.mu.Lock()
+	log.Debug().Msg("Memory store flushed")
+	ms.mu.Unlock()
 }
 
 func (ms *MemoryStore) Close() error {
 	log.Info().Msg("Closing memory store")
+	ms.Flush()
 	return nil
 }
\ No newline at end of file
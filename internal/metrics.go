@@ -0,0 +1,200 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/philippgille/chromem-go"
+)
+
+// Phase identifies a timed step of store operations.
+type Phase string
+
+const (
+	PhaseEmbed   Phase = "embed"
+	PhaseQuery   Phase = "query"
+	PhasePersist Phase = "persist"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the latency histogram
+// buckets. The statistical embedder is fast, so they start well below a
+// millisecond.
+var latencyBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+type histogram struct {
+	counts []uint64 // per bucket, plus one for +Inf
+	sum    float64
+	count  uint64
+}
+
+// LatencyMetrics records latency histograms per Phase since the store was
+// opened.
+type LatencyMetrics struct {
+	mu     sync.Mutex
+	phases map[Phase]*histogram
+}
+
+func NewLatencyMetrics() *LatencyMetrics {
+	return &LatencyMetrics{phases: make(map[Phase]*histogram)}
+}
+
+// Observe records that phase took d.
+func (m *LatencyMetrics) Observe(phase Phase, d time.Duration) {
+	seconds := d.Seconds()
+	i := sort.SearchFloat64s(latencyBuckets, seconds)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.phases[phase]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets)+1)}
+		m.phases[phase] = h
+	}
+	h.counts[i]++
+	h.sum += seconds
+	h.count++
+}
+
+// Since records the time elapsed since start, for use with defer.
+func (m *LatencyMetrics) Since(phase Phase, start time.Time) {
+	m.Observe(phase, time.Since(start))
+}
+
+// LatencySummary condenses a latency histogram for the dashboard. Quantiles
+// are estimated from the histogram buckets.
+type LatencySummary struct {
+	Count  uint64  `json:"count"`
+	MeanMs float64 `json:"mean_ms"`
+	P50Ms  float64 `json:"p50_ms"`
+	P95Ms  float64 `json:"p95_ms"`
+	P99Ms  float64 `json:"p99_ms"`
+}
+
+// Summary returns a LatencySummary for every phase observed so far.
+func (m *LatencyMetrics) Summary() map[Phase]LatencySummary {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	summary := make(map[Phase]LatencySummary, len(m.phases))
+	for phase, h := range m.phases {
+		summary[phase] = LatencySummary{
+			Count:  h.count,
+			MeanMs: h.sum / float64(h.count) * 1000,
+			P50Ms:  h.quantile(0.5) * 1000,
+			P95Ms:  h.quantile(0.95) * 1000,
+			P99Ms:  h.quantile(0.99) * 1000,
+		}
+	}
+	return summary
+}
+
+// quantile interpolates linearly within the bucket containing q, like
+// Prometheus' histogram_quantile. Observations above the largest bucket are
+// reported as its upper bound.
+func (h *histogram) quantile(q float64) float64 {
+	rank := q * float64(h.count)
+	var cumulative uint64
+	for i, n := range h.counts {
+		if float64(cumulative+n) < rank || n == 0 {
+			cumulative += n
+			continue
+		}
+		if i == len(latencyBuckets) {
+			return latencyBuckets[len(latencyBuckets)-1]
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = latencyBuckets[i-1]
+		}
+		return lower + (latencyBuckets[i]-lower)*(rank-float64(cumulative))/float64(n)
+	}
+	return 0
+}
+
+// timedEmbedding wraps embed so that every call is recorded as PhaseEmbed.
+func timedEmbedding(embed chromem.EmbeddingFunc, m *LatencyMetrics) chromem.EmbeddingFunc {
+	return func(ctx context.Context, text string) ([]float32, error) {
+		defer m.Since(PhaseEmbed, time.Now())
+		return embed(ctx, text)
+	}
+}
+
+// WritePrometheus writes the usage counters, latency histograms and document
+// count in the Prometheus text exposition format.
+func WritePrometheus(w io.Writer, stats *UsageStats, latency *LatencyMetrics, documents int) error {
+	pw := &promWriter{w: w}
+
+	pw.header("memory_operations_total", "counter", "Memory operations since the server started, by operation and channel.")
+	usage := stats.Snapshot()
+	for _, op := range sortedKeys(usage) {
+		for _, ch := range sortedKeys(usage[op]) {
+			pw.printf("memory_operations_total{operation=%q,channel=%q} %d\n", op, ch, usage[op][ch])
+		}
+	}
+
+	pw.header("memory_operations_lifetime_total", "counter", "Memory operations including earlier runs of the server, by operation and channel.")
+	lifetime := stats.Lifetime()
+	for _, op := range sortedKeys(lifetime) {
+		for _, ch := range sortedKeys(lifetime[op]) {
+			pw.printf("memory_operations_lifetime_total{operation=%q,channel=%q} %d\n", op, ch, lifetime[op][ch])
+		}
+	}
+
+	pw.header("memory_phase_duration_seconds", "histogram", "Latency of embedding, querying and persisting documents.")
+	latency.mu.Lock()
+	for _, phase := range sortedKeys(latency.phases) {
+		h := latency.phases[phase]
+		var cumulative uint64
+		for i, bound := range latencyBuckets {
+			cumulative += h.counts[i]
+			pw.printf("memory_phase_duration_seconds_bucket{phase=%q,le=%q} %d\n", phase, formatFloat(bound), cumulative)
+		}
+		pw.printf("memory_phase_duration_seconds_bucket{phase=%q,le=\"+Inf\"} %d\n", phase, h.count)
+		pw.printf("memory_phase_duration_seconds_sum{phase=%q} %s\n", phase, formatFloat(h.sum))
+		pw.printf("memory_phase_duration_seconds_count{phase=%q} %d\n", phase, h.count)
+	}
+	latency.mu.Unlock()
+
+	pw.header("memory_documents", "gauge", "Number of documents in the store.")
+	pw.printf("memory_documents %d\n", documents)
+
+	pw.header("memory_start_time_seconds", "gauge", "Start time of the server since the Unix epoch in seconds.")
+	pw.printf("memory_start_time_seconds %d\n", stats.StartedAt().Unix())
+
+	return pw.err
+}
+
+// promWriter keeps the first write error so that WritePrometheus can check
+// once at the end.
+type promWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (pw *promWriter) printf(format string, args ...any) {
+	if pw.err == nil {
+		_, pw.err = fmt.Fprintf(pw.w, format, args...)
+	}
+}
+
+func (pw *promWriter) header(name, kind, help string) {
+	pw.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func sortedKeys[K ~string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
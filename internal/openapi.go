@@ -0,0 +1,391 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+// apiVersion is the version of the REST API reported in the OpenAPI document.
+const apiVersion = "1.0.0"
+
+// apiOperation describes one REST operation for the OpenAPI document.
+// Request and response bodies are given as Go types, the same ones the
+// handlers decode and encode, so the schemas cannot drift from the code.
+type apiOperation struct {
+	Method      string
+	Path        string
+	ID          string
+	Tag         string
+	Summary     string
+	Description string
+	Params      []apiParam
+	// Request is the JSON request body, if any. RequestRequired overrides
+	// the required properties inferred from the type, for bodies whose
+	// server-assigned fields may be left out.
+	Request         reflect.Type
+	RequestRequired []string
+	RequestExample  any
+	// RequestMedia lists other accepted media types of the request body.
+	RequestMedia []string
+	// Status is the success status; Response its JSON body, unless
+	// ContentTypes lists other media types.
+	Status       int
+	Response     reflect.Type
+	ContentTypes []string
+	// Errors lists the error statuses besides 401, 403, 415, 500 and 503,
+	// which are added where they apply.
+	Errors []int
+	// Databases marks the database picker's operations, which are only
+	// served when switching databases is enabled.
+	Databases bool
+	// NoStore marks operations that work without an open database; the
+	// others return 503 until one is chosen in the picker.
+	NoStore bool
+}
+
+type apiParam struct {
+	Name        string
+	In          string
+	Type        string
+	Required    bool
+	Description string
+}
+
+func queryParam(name, typ, description string) apiParam {
+	return apiParam{Name: name, In: "query", Type: typ, Description: description}
+}
+
+var idParam = apiParam{Name: "id", In: "path", Type: "string", Required: true, Description: "Document ID"}
+
+var filterParams = []apiParam{
+	queryParam("tag", "string", "Only documents with this tag"),
+	queryParam("namespace", "string", "Only documents in this namespace"),
+}
+
+// apiOperations lists every REST endpoint served by WebServer.Handler.
+func apiOperations() []apiOperation {
+	documentType := reflect.TypeFor[Document]()
+	documentExample := map[string]any{
+		"content":    "How to fix null pointer in Go: always check if pointer is nil",
+		"tags":       []string{"golang", "debugging"},
+		"favorite":   true,
+		"properties": map[string]string{"category": "tip"},
+	}
+
+	return []apiOperation{
+		{
+			Method: http.MethodGet, Path: "/api/stats", ID: "getStats", Tag: "Statistics",
+			Summary:     "Get usage statistics",
+			Description: "Document count, per-operation and per-channel usage since startup and in total, daily history and latency percentiles.",
+			Status:      http.StatusOK, Response: reflect.TypeFor[StatsResponse](),
+		},
+		{
+			Method: http.MethodGet, Path: "/metrics", ID: "getMetrics", Tag: "Statistics",
+			Summary: "Get Prometheus metrics",
+			Status:  http.StatusOK, ContentTypes: []string{"text/plain"},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/documents", ID: "listDocuments", Tag: "Documents",
+			Summary: "List all documents",
+			Status:  http.StatusOK, Response: reflect.SliceOf(documentType),
+		},
+		{
+			Method: http.MethodPost, Path: "/api/documents", ID: "createDocument", Tag: "Documents",
+			Summary:     "Add a document",
+			Description: "The ID is generated unless one is given. created_at, score and the client fields of provenance are set by the server.",
+			Request:     documentType, RequestRequired: []string{"content"}, RequestExample: documentExample,
+			Status: http.StatusCreated, Response: reflect.TypeFor[DocumentStatus](),
+			Errors: []int{http.StatusBadRequest, http.StatusConflict, http.StatusUnprocessableEntity},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/documents/{id}", ID: "getDocument", Tag: "Documents",
+			Summary: "Get a document",
+			Params:  []apiParam{idParam},
+			Status:  http.StatusOK, Response: documentType,
+			Errors: []int{http.StatusNotFound},
+		},
+		{
+			Method: http.MethodPut, Path: "/api/documents/{id}", ID: "updateDocument", Tag: "Documents",
+			Summary:     "Replace a document",
+			Description: "Replaces content, tags, properties and favorite, re-embedding the content. Provenance is kept.",
+			Params:      []apiParam{idParam},
+			Request:     documentType, RequestRequired: []string{"content"}, RequestExample: documentExample,
+			Status: http.StatusOK, Response: reflect.TypeFor[DocumentStatus](),
+			Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity},
+		},
+		{
+			Method: http.MethodDelete, Path: "/api/documents/{id}", ID: "deleteDocument", Tag: "Documents",
+			Summary: "Delete a document",
+			Params:  []apiParam{idParam},
+			Status:  http.StatusOK, Response: reflect.TypeFor[DocumentStatus](),
+			Errors: []int{http.StatusNotFound},
+		},
+		{
+			Method: http.MethodPut, Path: "/api/documents/{id}/favorite", ID: "setFavorite", Tag: "Documents",
+			Summary:        "Mark or unmark a document as favorite",
+			Params:         []apiParam{idParam},
+			Request:        reflect.TypeFor[FavoriteRequest](),
+			RequestExample: FavoriteRequest{Favorite: true},
+			Status:         http.StatusOK, Response: reflect.TypeFor[DocumentStatus](),
+			Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/search", ID: "searchDocuments", Tag: "Search",
+			Summary: "Search documents by meaning",
+			Params: append([]apiParam{
+				{Name: "q", In: "query", Type: "string", Required: true, Description: "Search query"},
+				queryParam("limit", "integer", "Maximum number of results, 1-100 (default 10)"),
+				queryParam("threshold", "number", "Minimum similarity between 0 and 1 (default 0.1)"),
+				queryParam("client", "string", "Only documents created by this client"),
+				queryParam("source_repo", "string", "Only documents from this repository"),
+				queryParam("source_file", "string", "Only documents about this file"),
+			}, filterParams...),
+			Status: http.StatusOK, Response: reflect.SliceOf(documentType),
+			Errors: []int{http.StatusUnprocessableEntity},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/context", ID: "getContext", Tag: "Search",
+			Summary:     "Pack relevant memories into a token budget",
+			Description: "Same as the get_context MCP tool.",
+			Params: append([]apiParam{
+				{Name: "q", In: "query", Type: "string", Required: true, Description: "Task or question to find context for"},
+				queryParam("token_budget", "integer", fmt.Sprintf("Maximum estimated tokens (default %d, %d-%d)", DefaultTokenBudget, MinTokenBudget, MaxTokenBudget)),
+			}, filterParams...),
+			Status: http.StatusOK, Response: reflect.TypeFor[ContextBundle](),
+			Errors: []int{http.StatusUnprocessableEntity},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/export", ID: "exportDocuments", Tag: "Import and export",
+			Summary:     "Export documents",
+			Description: "Streams the documents matching the filters, oldest first, as a JSON array, JSON lines or CSV. CSV has the columns id, content, tags, favorite, created_at, the provenance fields and property.<key> for every property.",
+			Params: append([]apiParam{
+				queryParam("format", "string", "json (default), jsonl or csv"),
+				queryParam("client", "string", "Only documents created by this client"),
+				queryParam("source_repo", "string", "Only documents from this repository"),
+				queryParam("source_file", "string", "Only documents about this file"),
+			}, filterParams...),
+			Status:       http.StatusOK,
+			ContentTypes: []string{FormatJSON.ContentType(), FormatJSONL.ContentType(), FormatCSV.ContentType()},
+			Errors:       []int{http.StatusUnprocessableEntity},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/import", ID: "importDocuments", Tag: "Import and export",
+			Summary:     "Import documents",
+			Description: "Accepts the export formats, chosen by the format parameter or the Content-Type. IDs, creation times and provenance are kept when present. Rows that are invalid or whose ID is taken are listed in the report; 400 means the input could not be parsed and 413 that it is too large, each with the rows imported so far in details.",
+			Params: []apiParam{
+				queryParam("format", "string", "json, jsonl or csv; defaults to the Content-Type"),
+				queryParam("replace", "boolean", "Overwrite documents whose ID is taken instead of reporting a conflict"),
+			},
+			Request: reflect.SliceOf(documentType), RequestRequired: []string{"content"},
+			RequestExample: []any{documentExample},
+			RequestMedia:   []string{"application/x-ndjson", "text/csv"},
+			Status:         http.StatusOK, Response: reflect.TypeFor[ImportReport](),
+			Errors: []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/databases", ID: "listDatabases", Tag: "Databases",
+			Summary:     "List databases",
+			Description: "The open database, and the recently opened ones and others found in the database directory.",
+			Status:      http.StatusOK, Response: reflect.TypeFor[DatabaseList](),
+			Databases: true, NoStore: true,
+		},
+		{
+			Method: http.MethodPost, Path: "/api/databases", ID: "createDatabase", Tag: "Databases",
+			Summary:     "Create a database and switch to it",
+			Description: "Relative paths are resolved against the database directory; paths outside it are refused with 422. Requests in flight finish on the previous database.",
+			Request:     reflect.TypeFor[DatabaseRequest](), RequestExample: map[string]any{"path": "work-memories"},
+			Status: http.StatusCreated, Response: reflect.TypeFor[DatabaseInfo](),
+			Errors:    []int{http.StatusBadRequest, http.StatusConflict, http.StatusUnprocessableEntity},
+			Databases: true, NoStore: true,
+		},
+		{
+			Method: http.MethodPut, Path: "/api/databases/current", ID: "openDatabase", Tag: "Databases",
+			Summary:     "Switch to an existing database",
+			Description: "The path must be a memory database or an empty directory inside the database directory, against which relative paths are resolved.",
+			Request:     reflect.TypeFor[DatabaseRequest](), RequestExample: map[string]any{"path": "memory.db"},
+			Status: http.StatusOK, Response: reflect.TypeFor[DatabaseInfo](),
+			Errors:    []int{http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity},
+			Databases: true, NoStore: true,
+		},
+		{
+			Method: http.MethodGet, Path: "/api/openapi.json", ID: "getOpenAPI", Tag: "Meta",
+			Summary: "Get this OpenAPI document",
+			Status:  http.StatusOK, ContentTypes: []string{"application/json"},
+			NoStore: true,
+		},
+	}
+}
+
+// openAPIBuilder collects the component schemas referenced by operations.
+type openAPIBuilder struct {
+	schemas map[string]*jsonschema.Schema
+}
+
+// ref returns a schema for t, registering named types as components.
+func (b *openAPIBuilder) ref(t reflect.Type, required []string) (*jsonschema.Schema, error) {
+	if t.Kind() == reflect.Slice {
+		items, err := b.ref(t.Elem(), required)
+		if err != nil {
+			return nil, err
+		}
+		return &jsonschema.Schema{Type: "array", Items: items}, nil
+	}
+
+	name := t.Name()
+	if required != nil {
+		name += "Input"
+	}
+	if _, ok := b.schemas[name]; !ok {
+		schema, err := jsonschema.ForType(t, &jsonschema.ForOptions{
+			TypeSchemas: map[reflect.Type]*jsonschema.Schema{
+				reflect.TypeFor[time.Time](): {Type: "string", Format: "date-time"},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if required != nil {
+			schema.Required = required
+		}
+		b.schemas[name] = schema
+	}
+	return &jsonschema.Schema{Ref: "#/components/schemas/" + name}, nil
+}
+
+// OpenAPI returns the OpenAPI 3.1 document describing the REST API.
+func (ws *WebServer) OpenAPI() (map[string]any, error) {
+	b := &openAPIBuilder{schemas: make(map[string]*jsonschema.Schema)}
+	errorSchema, err := b.ref(reflect.TypeFor[APIError](), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]map[string]any)
+	for _, op := range apiOperations() {
+		if op.Databases && !ws.switchesDatabases() {
+			continue
+		}
+		operation := map[string]any{
+			"operationId": op.ID,
+			"tags":        []string{op.Tag},
+			"summary":     op.Summary,
+		}
+		if op.Description != "" {
+			operation["description"] = op.Description
+		}
+
+		var params []map[string]any
+		for _, p := range op.Params {
+			params = append(params, map[string]any{
+				"name":        p.Name,
+				"in":          p.In,
+				"required":    p.Required,
+				"description": p.Description,
+				"schema":      map[string]string{"type": p.Type},
+			})
+		}
+		if params != nil {
+			operation["parameters"] = params
+		}
+
+		if op.Request != nil {
+			schema, err := b.ref(op.Request, op.RequestRequired)
+			if err != nil {
+				return nil, err
+			}
+			media := map[string]any{"schema": schema}
+			if op.RequestExample != nil {
+				media["example"] = op.RequestExample
+			}
+			content := map[string]any{"application/json": media}
+			for _, mt := range op.RequestMedia {
+				content[mt] = map[string]any{"schema": map[string]string{"type": "string"}}
+			}
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content":  content,
+			}
+		}
+
+		success := map[string]any{"description": http.StatusText(op.Status)}
+		switch {
+		case op.Response != nil:
+			schema, err := b.ref(op.Response, nil)
+			if err != nil {
+				return nil, err
+			}
+			success["content"] = map[string]any{"application/json": map[string]any{"schema": schema}}
+		case op.ContentTypes != nil:
+			content := make(map[string]any)
+			for _, mt := range op.ContentTypes {
+				content[mt] = map[string]any{}
+			}
+			success["content"] = content
+		}
+		responses := map[string]any{fmt.Sprint(op.Status): success}
+		statuses := append([]int{http.StatusInternalServerError}, op.Errors...)
+		if ws.opts.Tokens != nil {
+			statuses = append(statuses, http.StatusUnauthorized)
+		}
+		if op.Request != nil && op.RequestMedia == nil {
+			// Bodies not sent as application/json
+			statuses = append(statuses, http.StatusUnsupportedMediaType)
+		}
+		if op.Method != http.MethodGet {
+			// Refused cross-site requests
+			statuses = append(statuses, http.StatusForbidden)
+		}
+		if ws.switchesDatabases() && !op.NoStore {
+			statuses = append(statuses, http.StatusServiceUnavailable)
+		}
+		for _, status := range statuses {
+			responses[fmt.Sprint(status)] = map[string]any{
+				"description": http.StatusText(status),
+				"content":     map[string]any{"application/json": map[string]any{"schema": errorSchema}},
+			}
+		}
+		operation["responses"] = responses
+
+		if paths[op.Path] == nil {
+			paths[op.Path] = make(map[string]any)
+		}
+		paths[op.Path][strings.ToLower(op.Method)] = operation
+	}
+
+	components := map[string]any{"schemas": b.schemas}
+	doc := map[string]any{
+		"openapi": "3.1.0",
+		"info": map[string]any{
+			"title":       "Memory Server REST API",
+			"version":     apiVersion,
+			"description": "Store, search and manage memories. Errors use the APIError schema; every response has an X-Request-ID header.",
+		},
+		"paths":      paths,
+		"components": components,
+	}
+	if ws.opts.Tokens != nil {
+		components["securitySchemes"] = map[string]any{
+			"bearerAuth": map[string]string{"type": "http", "scheme": "bearer"},
+		}
+		doc["security"] = []map[string][]string{{"bearerAuth": {}}}
+	}
+	return doc, nil
+}
+
+func (ws *WebServer) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+	doc, err := ws.OpenAPI()
+	if err != nil {
+		writeStoreError(w, r, err, "Failed to generate OpenAPI document")
+		return
+	}
+	writeJSON(w, http.StatusOK, doc)
+}
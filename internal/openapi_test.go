@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestAPIOperationsMatchRoutes keeps the OpenAPI document in step with the
+// mux: every operation must reach a route other than the dashboard's
+// catch-all with a method the route accepts, and every API route must be
+// described by an operation for each method it accepts.
+func TestAPIOperationsMatchRoutes(t *testing.T) {
+	dir := t.TempDir()
+	ws, _ := newTestWebServer(t, WebServerOptions{
+		SwitchDatabases:     true,
+		DatabaseDir:         dir,
+		RecentDatabasesPath: filepath.Join(dir, "recent.json"),
+	})
+	mux := http.NewServeMux()
+	for _, route := range ws.routes() {
+		mux.HandleFunc(route.Pattern, route.Handler)
+	}
+	handler := ws.Handler()
+
+	described := make(map[string]bool) // by route pattern
+	operations := make(map[string]bool)
+	paths := make(map[string]bool)
+	for _, op := range apiOperations() {
+		path := strings.ReplaceAll(op.Path, "{id}", "missing")
+		_, pattern := mux.Handler(httptest.NewRequest(op.Method, path, nil))
+		if pattern == "/" {
+			t.Errorf("%s %s (%s) is not routed", op.Method, op.Path, op.ID)
+			continue
+		}
+		described[pattern] = true
+		operations[op.Method+" "+path] = true
+		paths[path] = true
+	}
+
+	for _, route := range ws.routes() {
+		if !route.Page && !described[route.Pattern] {
+			t.Errorf("route %s is not described by apiOperations", route.Pattern)
+		}
+	}
+
+	methods := []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	for path := range paths {
+		for _, method := range methods {
+			rec := serve(handler, method, path, "", nil)
+			accepted := rec.Code != http.StatusMethodNotAllowed
+			switch described := operations[method+" "+path]; {
+			case accepted && !described:
+				t.Errorf("%s %s is served (status %d) but not described by apiOperations", method, path, rec.Code)
+			case !accepted && described:
+				t.Errorf("%s %s is described by apiOperations but refused with 405", method, path)
+			}
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// StatsFileName is the file in the DB directory that holds lifetime
+	// usage statistics. chromem ignores files at the top of its directory.
+	StatsFileName = "usage_stats.json"
+	// StatsPersistInterval is how often RunCombined saves usage statistics.
+	StatsPersistInterval = time.Minute
+	// HistoryDays is how many days of per-day counts are kept.
+	HistoryDays = 30
+
+	dayFormat = "2006-01-02"
+)
+
+// Operation identifies a memory operation for usage accounting.
+type Operation string
+
+const (
+	OpAddDocument     Operation = "add_document"
+	OpGetDocument     Operation = "get_document"
+	OpGetAllDocuments Operation = "get_all_documents"
+	OpUpdateDocument  Operation = "update_document"
+	OpDeleteDocument  Operation = "delete_document"
+	OpSearch          Operation = "search"
+	OpReindex         Operation = "reindex"
+	OpGetContext      Operation = "get_context"
+	OpGraphRead       Operation = "graph_read"
+	OpGraphWrite      Operation = "graph_write"
+	OpExport          Operation = "export"
+	OpImport          Operation = "import"
+)
+
+// Channel identifies the front end through which an operation was invoked.
+type Channel string
+
+const (
+	ChannelMCP  Channel = "mcp"
+	ChannelREST Channel = "rest"
+)
+
+// UsageStats counts operations per channel. A single instance is shared by
+// the MCP and web servers so the dashboard reflects agent activity as well as
+// REST calls.
+//
+// Counts since the process started are kept separately from the totals of
+// earlier runs, which are loaded from and saved to a file by LoadUsageStats
+// and Save.
+type UsageStats struct {
+	mu        sync.Mutex
+	counts    map[Operation]map[Channel]int64
+	previous  map[Operation]map[Channel]int64
+	daily     map[string]map[Operation]int64 // keyed by local date, see dayFormat
+	startedAt time.Time
+	path      string
+}
+
+// usageStatsFile is the on-disk format of UsageStats.
+type usageStatsFile struct {
+	Counts    map[Operation]map[Channel]int64 `json:"counts"`
+	History   map[string]map[Operation]int64  `json:"history,omitempty"`
+	UpdatedAt time.Time                       `json:"updated_at"`
+}
+
+// NewUsageStats returns in-memory statistics that are not persisted.
+func NewUsageStats() *UsageStats {
+	return &UsageStats{
+		counts:    make(map[Operation]map[Channel]int64),
+		previous:  make(map[Operation]map[Channel]int64),
+		daily:     make(map[string]map[Operation]int64),
+		startedAt: time.Now(),
+	}
+}
+
+// LoadUsageStats returns statistics persisted at path, which is created by
+// the first Save if it does not exist yet.
+func LoadUsageStats(path string) (*UsageStats, error) {
+	u := NewUsageStats()
+	u.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return u, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read usage stats: %w", err)
+	}
+	var file usageStatsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse usage stats %s: %w", path, err)
+	}
+	if file.Counts != nil {
+		u.previous = file.Counts
+	}
+	if file.History != nil {
+		u.daily = file.History
+	}
+	return u, nil
+}
+
+// Record counts one invocation of op through ch.
+func (u *UsageStats) Record(op Operation, ch Channel) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	byChannel, ok := u.counts[op]
+	if !ok {
+		byChannel = make(map[Channel]int64)
+		u.counts[op] = byChannel
+	}
+	byChannel[ch]++
+
+	today := time.Now().Format(dayFormat)
+	byOp, ok := u.daily[today]
+	if !ok {
+		byOp = make(map[Operation]int64)
+		u.daily[today] = byOp
+		u.pruneHistory()
+	}
+	byOp[op]++
+}
+
+// pruneHistory drops days older than HistoryDays.
+func (u *UsageStats) pruneHistory() {
+	oldest := time.Now().AddDate(0, 0, -HistoryDays+1).Format(dayFormat)
+	for day := range u.daily {
+		if day < oldest {
+			delete(u.daily, day)
+		}
+	}
+}
+
+// DayUsage is the number of operations on one day.
+type DayUsage struct {
+	Date   string              `json:"date"`
+	Counts map[Operation]int64 `json:"counts"`
+}
+
+// History returns the per-day counts of the last HistoryDays days, oldest
+// first. Days without activity have empty counts.
+func (u *UsageStats) History() []DayUsage {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := time.Now()
+	history := make([]DayUsage, 0, HistoryDays)
+	for i := HistoryDays - 1; i >= 0; i-- {
+		day := now.AddDate(0, 0, -i).Format(dayFormat)
+		counts := make(map[Operation]int64, len(u.daily[day]))
+		for op, n := range u.daily[day] {
+			counts[op] = n
+		}
+		history = append(history, DayUsage{Date: day, Counts: counts})
+	}
+	return history
+}
+
+// Total returns the number of invocations of op across all channels since
+// the process started.
+func (u *UsageStats) Total(op Operation) int64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	var total int64
+	for _, n := range u.counts[op] {
+		total += n
+	}
+	return total
+}
+
+// LifetimeTotal is like Total but includes the persisted counts of earlier
+// runs.
+func (u *UsageStats) LifetimeTotal(op Operation) int64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	var total int64
+	for _, counts := range []map[Operation]map[Channel]int64{u.previous, u.counts} {
+		for _, n := range counts[op] {
+			total += n
+		}
+	}
+	return total
+}
+
+// Snapshot returns a copy of the counters since the process started, keyed
+// by operation, then channel.
+func (u *UsageStats) Snapshot() map[Operation]map[Channel]int64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return addCounts(nil, u.counts)
+}
+
+// Lifetime is like Snapshot but includes the persisted counts of earlier
+// runs.
+func (u *UsageStats) Lifetime() map[Operation]map[Channel]int64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.lifetime()
+}
+
+func (u *UsageStats) lifetime() map[Operation]map[Channel]int64 {
+	return addCounts(addCounts(nil, u.previous), u.counts)
+}
+
+// StartedAt returns when counting for Snapshot and Total began.
+func (u *UsageStats) StartedAt() time.Time {
+	return u.startedAt
+}
+
+// Save writes the lifetime counts to the file the statistics were loaded
+// from. It does nothing for statistics created with NewUsageStats.
+func (u *UsageStats) Save() error {
+	if u.path == "" {
+		return nil
+	}
+
+	u.mu.Lock()
+	u.pruneHistory()
+	data, err := json.MarshalIndent(usageStatsFile{Counts: u.lifetime(), History: u.daily, UpdatedAt: time.Now()}, "", "  ")
+	u.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode usage stats: %w", err)
+	}
+
+	// Write to a temporary file first so that a crash never leaves a
+	// truncated file behind.
+	tmp, err := os.CreateTemp(filepath.Dir(u.path), filepath.Base(u.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to save usage stats: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save usage stats: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save usage stats: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), u.path); err != nil {
+		return fmt.Errorf("failed to save usage stats: %w", err)
+	}
+	return nil
+}
+
+// Persist saves the statistics every interval until ctx is cancelled, and
+// once more before returning.
+func (u *UsageStats) Persist(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := u.Save(); err != nil {
+				log.Error().Err(err).Msg("Failed to persist usage stats")
+			}
+		case <-ctx.Done():
+			return u.Save()
+		}
+	}
+}
+
+// addCounts adds src to dst, allocating dst if it is nil, and returns dst.
+func addCounts(dst, src map[Operation]map[Channel]int64) map[Operation]map[Channel]int64 {
+	if dst == nil {
+		dst = make(map[Operation]map[Channel]int64, len(src))
+	}
+	for op, byChannel := range src {
+		if dst[op] == nil {
+			dst[op] = make(map[Channel]int64, len(byChannel))
+		}
+		for ch, n := range byChannel {
+			dst[op][ch] += n
+		}
+	}
+	return dst
+}
@@ -0,0 +1,543 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// Format is a file format for exporting and importing memories.
+type Format string
+
+const (
+	// FormatJSON is a JSON array of documents.
+	FormatJSON Format = "json"
+	// FormatJSONL has one JSON document per line.
+	FormatJSONL Format = "jsonl"
+	// FormatCSV has a header row and one document per row; see csvColumns.
+	FormatCSV Format = "csv"
+)
+
+// csvPropertyPrefix prefixes CSV columns holding document properties, e.g.
+// "property.namespace".
+const csvPropertyPrefix = "property."
+
+const (
+	// maxImportSize bounds the body of POST /api/import.
+	maxImportSize = 256 * 1024 * 1024
+	// maxImportLineSize bounds a single line of a JSONL import.
+	maxImportLineSize = 16 * 1024 * 1024
+)
+
+// ErrMalformedInput is returned when an import cannot be read at all, as
+// opposed to single rows that are reported in ImportReport.Errors.
+var ErrMalformedInput = errors.New("malformed input")
+
+// ParseFormat parses "json", "jsonl" (or "ndjson") and "csv".
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(strings.TrimPrefix(s, ".")) {
+	case "json":
+		return FormatJSON, nil
+	case "jsonl", "ndjson":
+		return FormatJSONL, nil
+	case "csv":
+		return FormatCSV, nil
+	}
+	return "", fmt.Errorf("unknown format %q: use json, jsonl or csv", s)
+}
+
+// ContentType returns the media type of f.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatJSONL:
+		return "application/x-ndjson"
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	}
+	return "application/json"
+}
+
+// csvColumns are the fixed CSV columns, followed by the provenance columns
+// and one column per property key.
+var csvColumns = []string{"id", "content", "tags", "favorite", "created_at"}
+
+// provenanceColumns returns the provenance metadata keys in a stable order.
+func provenanceColumns() []string {
+	return sortedKeys(provenanceKeys(&Provenance{}))
+}
+
+// exportPageSize is how many documents an export fetches before flushing.
+const exportPageSize = 200
+
+// ExportDocuments writes the documents matching filter to w, oldest first,
+// and returns how many were written. Selecting them loads the whole store
+// once, but only the IDs of the selected documents are kept; the documents
+// themselves are fetched and encoded a page at a time, so the output can be
+// streamed.
+func ExportDocuments(store *MemoryStore, w io.Writer, format Format, filter DocumentFilter) (int, error) {
+	selection, err := selectExport(store, filter)
+	if err != nil {
+		return 0, err
+	}
+	return selection.write(store, w, format, nil)
+}
+
+// write exports the selected documents to w in format. afterPage, if not
+// nil, is called after each page, e.g. to flush a response and extend its
+// deadline.
+func (sel exportSelection) write(store *MemoryStore, w io.Writer, format Format, afterPage func() error) (int, error) {
+	n := 0
+	docs := func(yield func(Document, error) bool) {
+		for start := 0; start < len(sel.ids); start += exportPageSize {
+			for _, id := range sel.ids[start:min(start+exportPageSize, len(sel.ids))] {
+				doc, err := store.GetDocument(id)
+				if errors.Is(err, ErrDocumentNotFound) {
+					// Deleted since the export started
+					continue
+				}
+				if !yield(doc, err) || err != nil {
+					return
+				}
+				n++
+			}
+			if afterPage != nil {
+				if err := afterPage(); err != nil {
+					yield(Document{}, err)
+					return
+				}
+			}
+		}
+	}
+
+	var err error
+	switch format {
+	case FormatJSON:
+		err = exportJSON(w, docs)
+	case FormatJSONL:
+		err = exportJSONL(w, docs)
+	case FormatCSV:
+		err = exportCSV(w, docs, sel.properties)
+	default:
+		err = fmt.Errorf("unknown format %q", format)
+	}
+	if err != nil {
+		return n, fmt.Errorf("failed to export documents: %w", err)
+	}
+
+	log.Info().Int("count", n).Str("format", string(format)).Msg("Exported documents")
+	return n, nil
+}
+
+// documentSeq yields documents, or an error that ends the sequence.
+type documentSeq = iter.Seq2[Document, error]
+
+// exportSelection lists the documents an export writes.
+type exportSelection struct {
+	// ids are oldest first.
+	ids []string
+	// properties are the sorted property keys of the documents, which CSV
+	// needs for its header.
+	properties []string
+}
+
+// selectExport selects the documents matching filter.
+func selectExport(store *MemoryStore, filter DocumentFilter) (exportSelection, error) {
+	type entry struct {
+		id        string
+		createdAt time.Time
+	}
+	var entries []entry
+	seen := make(map[string]bool)
+	var selection exportSelection
+	err := store.EachDocument(func(doc Document) bool {
+		if !filter.Matches(doc) {
+			return true
+		}
+		entries = append(entries, entry{doc.ID, doc.CreatedAt})
+		for key := range doc.Properties {
+			if !seen[key] {
+				seen[key] = true
+				selection.properties = append(selection.properties, key)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return exportSelection{}, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if !a.createdAt.Equal(b.createdAt) {
+			return a.createdAt.Before(b.createdAt)
+		}
+		return a.id < b.id
+	})
+	selection.ids = make([]string, len(entries))
+	for i, e := range entries {
+		selection.ids[i] = e.id
+	}
+	sort.Strings(selection.properties)
+	return selection, nil
+}
+
+func exportJSON(w io.Writer, docs documentSeq) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	sep := "\n"
+	for doc, err := range docs {
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, sep); err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		sep = ",\n"
+	}
+	_, err := io.WriteString(w, "\n]\n")
+	return err
+}
+
+func exportJSONL(w io.Writer, docs documentSeq) error {
+	enc := json.NewEncoder(w)
+	for doc, err := range docs {
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func exportCSV(w io.Writer, docs documentSeq, properties []string) error {
+	provenance := provenanceColumns()
+	header := append([]string{}, csvColumns...)
+	header = append(header, provenance...)
+	for _, key := range properties {
+		header = append(header, csvPropertyPrefix+key)
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for doc, err := range docs {
+		if err != nil {
+			return err
+		}
+		record := []string{
+			doc.ID,
+			doc.Content,
+			strings.Join(doc.Tags, ", "),
+			strconv.FormatBool(doc.Favorite),
+			doc.CreatedAt.Format(time.RFC3339),
+		}
+		fields := provenanceKeys(&doc.Provenance)
+		for _, key := range provenance {
+			record = append(record, *fields[key])
+		}
+		for _, key := range properties {
+			record = append(record, doc.Properties[key])
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ImportOptions configures ImportDocuments.
+type ImportOptions struct {
+	// Replace overwrites documents whose ID is already taken instead of
+	// reporting a conflict.
+	Replace bool
+	// Client is the Provenance.Client of documents that do not name one.
+	Client string
+	// OnlySourceProvenance makes Client the Provenance.Client of every
+	// document and drops the client version and session ID of the input, so
+	// that, as with POST /api/documents, only the source fields can be
+	// supplied and imports cannot pass for an MCP client's memories.
+	OnlySourceProvenance bool
+	// AfterRow, if set, is called after each row has been stored or
+	// rejected.
+	AfterRow func()
+}
+
+// ImportError describes a row that could not be imported. Code is one of
+// the REST API error codes.
+type ImportError struct {
+	// Row is the 1-based element of a JSON array, or the line of a JSONL or
+	// CSV file.
+	Row     int    `json:"row"`
+	ID      string `json:"id,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ImportReport describes the outcome of ImportDocuments.
+type ImportReport struct {
+	Imported int           `json:"imported"`
+	Replaced int           `json:"replaced"`
+	Errors   []ImportError `json:"errors,omitempty"`
+}
+
+func (r ImportReport) String() string {
+	text := fmt.Sprintf("Imported %d documents (%d replaced)", r.Imported, r.Replaced)
+	if len(r.Errors) > 0 {
+		lines := make([]string, len(r.Errors))
+		for i, e := range r.Errors {
+			lines[i] = fmt.Sprintf("row %d: %s", e.Row, e.Message)
+		}
+		text += fmt.Sprintf("; %d rows failed:\n%s", len(r.Errors), strings.Join(lines, "\n"))
+	}
+	return text
+}
+
+// ImportDocuments reads documents in format from r and stores them. IDs and
+// creation times are kept when present and generated otherwise. Rows that
+// are invalid or whose ID is taken are reported in the result; an error is
+// only returned if the input cannot be parsed (ErrMalformedInput) or storing
+// fails.
+func ImportDocuments(store *MemoryStore, r io.Reader, format Format, opts ImportOptions) (ImportReport, error) {
+	var report ImportReport
+	add := func(row int, doc Document) error {
+		err := importDocument(store, row, doc, opts, &report)
+		if opts.AfterRow != nil {
+			opts.AfterRow()
+		}
+		return err
+	}
+
+	var err error
+	switch format {
+	case FormatJSON:
+		err = importJSON(r, add, &report)
+	case FormatJSONL:
+		err = importJSONL(r, add, &report)
+	case FormatCSV:
+		err = importCSV(r, add, &report)
+	default:
+		err = fmt.Errorf("unknown format %q", format)
+	}
+
+	log.Info().
+		Int("imported", report.Imported).
+		Int("replaced", report.Replaced).
+		Int("errors", len(report.Errors)).
+		Str("format", string(format)).
+		Msg("Imported documents")
+	return report, err
+}
+
+// importDocument stores doc, recording rejected rows in report. Only
+// storage failures are returned.
+func importDocument(store *MemoryStore, row int, doc Document, opts ImportOptions, report *ImportReport) error {
+	// Errors only name IDs from the input
+	id := doc.ID
+	if doc.ID == "" {
+		doc.ID = uuid.New().String()
+	}
+	if doc.CreatedAt.IsZero() {
+		doc.CreatedAt = time.Now()
+	}
+	if doc.Provenance.Client == "" || opts.OnlySourceProvenance {
+		doc.Provenance.Client = opts.Client
+	}
+	if opts.OnlySourceProvenance {
+		doc.Provenance.ClientVersion = ""
+		doc.Provenance.SessionID = ""
+	}
+	doc.Score = 0
+
+	err := store.CreateDocument(doc)
+	if errors.Is(err, ErrDocumentExists) && opts.Replace {
+		if err = store.UpdateDocument(doc); err == nil {
+			report.Replaced++
+		}
+	}
+
+	var invalid *ValidationError
+	switch {
+	case err == nil:
+		report.Imported++
+	case errors.Is(err, ErrDocumentExists):
+		report.Errors = append(report.Errors, ImportError{Row: row, ID: id, Code: codeConflict, Message: err.Error()})
+	case errors.As(err, &invalid):
+		report.Errors = append(report.Errors, ImportError{Row: row, ID: id, Code: codeValidationFailed, Message: err.Error()})
+	default:
+		return fmt.Errorf("row %d: %w", row, err)
+	}
+	return nil
+}
+
+func invalidRow(report *ImportReport, row int, err error) {
+	report.Errors = append(report.Errors, ImportError{Row: row, Code: codeValidationFailed, Message: err.Error()})
+}
+
+func importJSON(r io.Reader, add func(int, Document) error, report *ImportReport) error {
+	dec := json.NewDecoder(r)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return fmt.Errorf("%w: expected a JSON array of documents", ErrMalformedInput)
+	}
+	for row := 1; dec.More(); row++ {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return fmt.Errorf("%w: element %d: %w", ErrMalformedInput, row, err)
+		}
+		var doc Document
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			invalidRow(report, row, err)
+			continue
+		}
+		if err := add(row, doc); err != nil {
+			return err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("%w: %w", ErrMalformedInput, err)
+	}
+	return nil
+}
+
+func importJSONL(r io.Reader, add func(int, Document) error, report *ImportReport) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxImportLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var doc Document
+		if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+			invalidRow(report, line, err)
+			continue
+		}
+		if err := add(line, doc); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); errors.Is(err, bufio.ErrTooLong) {
+		return fmt.Errorf("%w: a line is longer than %d bytes", ErrMalformedInput, maxImportLineSize)
+	} else if err != nil {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+	return nil
+}
+
+func importCSV(r io.Reader, add func(int, Document) error, report *ImportReport) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("%w: cannot read CSV header: %w", ErrMalformedInput, err)
+	}
+
+	known := make(map[string]bool)
+	for _, column := range append(append([]string{}, csvColumns...), provenanceColumns()...) {
+		known[column] = true
+	}
+	hasContent := false
+	for i, column := range header {
+		column = strings.TrimSpace(column)
+		header[i] = column
+		if !known[column] && !strings.HasPrefix(column, csvPropertyPrefix) {
+			return fmt.Errorf("%w: unknown CSV column %q: use %s, %s or %s<key>", ErrMalformedInput,
+				column, strings.Join(csvColumns, ", "), strings.Join(provenanceColumns(), ", "), csvPropertyPrefix)
+		}
+		hasContent = hasContent || column == "content"
+	}
+	if !hasContent {
+		return fmt.Errorf("%w: the CSV header has no content column", ErrMalformedInput)
+	}
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrMalformedInput, err)
+		}
+		line, _ := cr.FieldPos(0)
+		if len(record) != len(header) {
+			invalidRow(report, line, fmt.Errorf("expected %d fields, got %d", len(header), len(record)))
+			continue
+		}
+		doc, err := csvDocument(header, record)
+		if err != nil {
+			invalidRow(report, line, err)
+			continue
+		}
+		if err := add(line, doc); err != nil {
+			return err
+		}
+	}
+}
+
+// csvDocument builds a document from a CSV record. Empty cells are treated
+// as absent.
+func csvDocument(header, record []string) (Document, error) {
+	var doc Document
+	provenance := provenanceKeys(&doc.Provenance)
+	for i, column := range header {
+		value := record[i]
+		if value == "" {
+			continue
+		}
+		switch column {
+		case "id":
+			doc.ID = value
+		case "content":
+			doc.Content = value
+		case "tags":
+			for _, tag := range strings.Split(value, ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					doc.Tags = append(doc.Tags, tag)
+				}
+			}
+		case "favorite":
+			favorite, err := strconv.ParseBool(value)
+			if err != nil {
+				return doc, &ValidationError{Field: "favorite", Reason: fmt.Sprintf("%q is not true or false", value)}
+			}
+			doc.Favorite = favorite
+		case "created_at":
+			created, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return doc, &ValidationError{Field: "created_at", Reason: fmt.Sprintf("%q is not an RFC 3339 time", value)}
+			}
+			doc.CreatedAt = created
+		default:
+			if field, ok := provenance[column]; ok {
+				*field = value
+				continue
+			}
+			if doc.Properties == nil {
+				doc.Properties = make(map[string]string)
+			}
+			doc.Properties[strings.TrimPrefix(column, csvPropertyPrefix)] = value
+		}
+	}
+	return doc, nil
+}
@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"html"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"mcpchromem/web"
+)
+
+// classicPath serves the inline dashboard next to the app, so that it stays
+// reachable once the app is built.
+const classicPath = "/classic"
+
+// markdownScriptPath serves the app's markdown renderer to the inline
+// dashboard, so that both render memories with the same code.
+const markdownScriptPath = classicPath + "/markdown.js"
+
+// appConfig is passed to the single-page app in a meta tag of index.html,
+// as renderPage passes the same facts to the inline pages.
+type appConfig struct {
+	Auth            bool   `json:"auth"`
+	SwitchDatabases bool   `json:"switch_databases"`
+	Database        string `json:"database,omitempty"`
+}
+
+// contentSecurityPolicy returns the policy of the dashboard pages, which may
+// only run scripts from scriptSrc.
+func contentSecurityPolicy(scriptSrc string) string {
+	return "default-src 'self'; script-src " + scriptSrc + "; style-src 'self' 'unsafe-inline'; img-src 'self' data:; object-src 'none'; base-uri 'none'; form-action 'self'"
+}
+
+// serveApp serves the single-page app. Files of the build are served as is;
+// any other path is a client-side route and gets index.html, so that links
+// to pages such as /documents survive a reload. Unknown API paths and
+// missing assets are still 404s.
+func (ws *WebServer) serveApp(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "No such page or endpoint: "+r.URL.Path, nil)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+	if name != "" && name != "index.html" {
+		if info, err := fs.Stat(ws.app, name); err == nil && !info.IsDir() {
+			// Vite fingerprints everything under assets/.
+			if strings.HasPrefix(name, "assets/") {
+				w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+			}
+			http.ServeFileFS(w, r, ws.app, name)
+			return
+		}
+		if path.Ext(name) != "" {
+			writeError(w, r, http.StatusNotFound, codeNotFound, "No such file: "+r.URL.Path, nil)
+			return
+		}
+	}
+
+	store := ws.Store()
+	if store == nil {
+		http.Redirect(w, r, databasesPath, http.StatusSeeOther)
+		return
+	}
+
+	index, err := fs.ReadFile(ws.app, "index.html")
+	if err != nil {
+		zerolog.Ctx(r.Context()).Error().Err(err).Msg("Failed to read app index")
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	config := appConfig{
+		Auth:            ws.opts.Tokens != nil,
+		SwitchDatabases: ws.switchesDatabases(),
+		Database:        store.Path(),
+	}
+	data, _ := json.Marshal(config)
+	meta := `<meta name="memory-server" content="` + html.EscapeString(string(data)) + `">`
+	index = bytes.Replace(index, []byte("</head>"), []byte(meta+"</head>"), 1)
+
+	w.Header().Set("Content-Security-Policy", contentSecurityPolicy("'self'"))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(index)
+}
+
+// handleMarkdownScript serves web.Markdown.
+func (ws *WebServer) handleMarkdownScript(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(web.Markdown())
+}
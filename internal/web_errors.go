@@ -0,0 +1,170 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// requestIDHeader carries the request ID. A well-formed ID sent by the client
+// is kept, so that calls can be traced across services; otherwise one is
+// generated. Either way it is echoed in the response and in every log line.
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds client-supplied request IDs.
+const maxRequestIDLength = 128
+
+// Error codes of the REST API. Clients should branch on these rather than on
+// the message, which is meant for humans.
+const (
+	codeInvalidJSON      = "invalid_json"
+	codeInvalidInput     = "invalid_input"
+	codeValidationFailed = "validation_failed"
+	codeNotFound         = "not_found"
+	codeConflict         = "conflict"
+	codeTooLarge         = "too_large"
+	codeUnsupportedMedia = "unsupported_media_type"
+	codeMethodNotAllowed = "method_not_allowed"
+	codeUnauthorized     = "unauthorized"
+	codeForbidden        = "forbidden"
+	codeNoDatabase       = "no_database"
+	codeInternal         = "internal"
+)
+
+// APIError is the body of every REST API error response.
+type APIError struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Details   any    `json:"details,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+type requestIDKey struct{}
+
+// requestID returns the ID assigned to r by withRequestID.
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// withRequestID assigns every request an ID, returns it in the X-Request-ID
+// header, attaches a logger carrying it to the request context (see
+// zerolog.Ctx) and logs the outcome of the request.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.New().String()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		logger := log.With().Str("request_id", id).Logger()
+		ctx := context.WithValue(logger.WithContext(r.Context()), requestIDKey{}, id)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		logger.Info().
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Int("status", rec.status).
+			Dur("duration", time.Since(start)).
+			Msg("HTTP request")
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// statusRecorder remembers the status code written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// writeJSON writes v as the JSON response body with the given status.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an APIError response.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string, details any) {
+	writeJSON(w, status, APIError{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: requestID(r),
+	})
+}
+
+// writeStoreError maps an error from MemoryStore to a response: missing
+// documents and databases are 404, taken IDs and database paths 409,
+// invalid documents 422 and unreadable imports 400. Anything else is logged with msg and reported as a 500
+// without leaking the cause.
+func writeStoreError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	var invalid *ValidationError
+	switch {
+	case errors.Is(err, ErrDocumentNotFound), errors.Is(err, ErrDatabaseNotFound):
+		writeError(w, r, http.StatusNotFound, codeNotFound, err.Error(), nil)
+	case errors.Is(err, ErrDocumentExists), errors.Is(err, ErrDatabaseExists):
+		writeError(w, r, http.StatusConflict, codeConflict, err.Error(), nil)
+	case errors.Is(err, ErrMalformedInput):
+		writeError(w, r, http.StatusBadRequest, codeInvalidInput, err.Error(), nil)
+	case errors.As(err, &invalid):
+		writeError(w, r, http.StatusUnprocessableEntity, codeValidationFailed, err.Error(), map[string]string{"field": invalid.Field})
+	default:
+		zerolog.Ctx(r.Context()).Error().Err(err).Msg(msg)
+		writeError(w, r, http.StatusInternalServerError, codeInternal, "Internal server error", nil)
+	}
+}
+
+// writeInvalidParam reports a missing or malformed query parameter.
+func writeInvalidParam(w http.ResponseWriter, r *http.Request, param, message string) {
+	writeError(w, r, http.StatusUnprocessableEntity, codeValidationFailed, message, map[string]string{"parameter": param})
+}
+
+func writeMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, "Method "+r.Method+" not allowed", nil)
+}
+
+// decodeJSON decodes the request body into v, writing an error response and
+// returning false if it is not valid JSON. The body must be declared as
+// application/json: browsers send other types, such as the text/plain of a
+// cross-site form, without asking the server first.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if mediaType(r.Header.Get("Content-Type")) != "application/json" {
+		writeError(w, r, http.StatusUnsupportedMediaType, codeUnsupportedMedia, "Request body must be sent as application/json", nil)
+		return false
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidJSON, "Request body is not valid JSON", err.Error())
+		return false
+	}
+	return true
+}
@@ -1,30 +1,76 @@
 package internal
 
 import (
-	"encoding/json"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"html/template"
+	"io/fs"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+
+	"mcpchromem/web"
 )
 
 type WebServer struct {
-	store     *MemoryStore
-	stats     *ServerStats
+	// mu guards store, which the database picker replaces at runtime.
+	// Handlers get the store through withStore and storeOf.
+	mu    sync.RWMutex
+	store *MemoryStore
+	// ownsStore is set once the store was opened by the picker, so the web
+	// server closes it when switching away or shutting down.
+	ownsStore bool
+	// inFlight counts the requests using each store, see withStore, so that
+	// a store the picker switched away from is only closed once they have
+	// finished. closing tracks those pending closes.
+	inFlight  map[*MemoryStore]*sync.WaitGroup
+	closing   sync.WaitGroup
+	stats     *UsageStats
+	opts      WebServerOptions
 	templates *template.Template
+	login     *template.Template
+	explorer  *template.Template
+	picker    *template.Template
+	// app is the single-page dashboard, or nil to serve the inline one.
+	app fs.FS
 }
 
-type ServerStats struct {
-	GetDocumentCount    int64 `json:"get_document_count"`
-	GetAllDocuments     int64 `json:"get_all_documents"`
-	DeleteDocumentCount int64 `json:"delete_document_count"`
-	AddDocumentCount    int64 `json:"add_document_count"`
-	SearchCount         int64 `json:"search_count"`
+// WebServerOptions configures optional web server behaviour. A nil
+// *WebServerOptions selects the defaults.
+type WebServerOptions struct {
+	// Host is the interface to listen on. Defaults to 127.0.0.1, so the
+	// dashboard is only reachable from this machine; use "0.0.0.0" to
+	// listen on all interfaces.
+	Host string
+	// Tokens, if set, requires an API token for the REST API and a login
+	// for the dashboard.
+	Tokens *TokenStore
+	// SwitchDatabases enables the database picker, which opens, creates
+	// and switches databases at runtime. It is implied when the web server
+	// starts without a store. Leave it off when the store is shared with
+	// the MCP server, which would keep using the old one.
+	SwitchDatabases bool
+	// DatabaseDir is where the picker looks for databases and creates new
+	// ones. Defaults to the working directory.
+	DatabaseDir string
+	// RecentDatabasesPath is the file listing recently opened databases.
+	// Defaults to recent_databases.json in the user's config directory.
+	RecentDatabasesPath string
+	// App replaces the dashboard app embedded from web/dist, e.g. with
+	// os.DirFS("web/dist") to serve a fresh build without recompiling.
+	App fs.FS
 }
 
 type WebDocument struct {
@@ -32,15 +78,62 @@ type WebDocument struct {
 	TagsString string `json:"tags_string"`
 }
 
-func NewWebServer(store *MemoryStore) *WebServer {
+// The request and response bodies of the REST API. The OpenAPI document is
+// generated from these types, so handlers must use them rather than ad-hoc
+// maps.
+
+// StatsResponse is returned by GET /api/stats.
+type StatsResponse struct {
+	TotalDocuments      int                             `json:"total_documents"`
+	AddDocumentCount    int64                           `json:"add_document_count"`
+	SearchCount         int64                           `json:"search_count"`
+	DeleteDocumentCount int64                           `json:"delete_document_count"`
+	GetDocumentCount    int64                           `json:"get_document_count"`
+	GetAllDocuments     int64                           `json:"get_all_documents"`
+	UpdateDocumentCount int64                           `json:"update_document_count"`
+	Usage               map[Operation]map[Channel]int64 `json:"usage"`
+	LifetimeUsage       map[Operation]map[Channel]int64 `json:"lifetime_usage"`
+	StartedAt           time.Time                       `json:"started_at"`
+	History             []DayUsage                      `json:"history"`
+	Latency             map[Phase]LatencySummary        `json:"latency"`
+}
+
+// DocumentStatus is returned by requests that change a document.
+type DocumentStatus struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	// Favorite is only set by the favorite endpoint.
+	Favorite *bool `json:"favorite,omitempty"`
+}
+
+// FavoriteRequest is the body of PUT /api/documents/{id}/favorite.
+type FavoriteRequest struct {
+	Favorite bool `json:"favorite"`
+}
+
+func NewWebServer(store *MemoryStore, stats *UsageStats, opts *WebServerOptions) *WebServer {
 	ws := &WebServer{
-		store: store,
-		stats: &ServerStats{},
+		store:    store,
+		stats:    stats,
+		inFlight: make(map[*MemoryStore]*sync.WaitGroup),
+	}
+	if store != nil {
+		ws.inFlight[store] = &sync.WaitGroup{}
 	}
-	
+	if opts != nil {
+		ws.opts = *opts
+	}
+	if store == nil {
+		ws.opts.SwitchDatabases = true
+	}
+	ws.app = ws.opts.App
+	if ws.app == nil {
+		ws.app = web.Dist()
+	}
+
 	// Parse HTML templates
 	ws.loadTemplates()
-	
+
 	return ws
 }
 
@@ -60,6 +153,7 @@ func (ws *WebServer) loadTemplates() {
         .stat-card { background: #007bff; color: white; padding: 15px; border-radius: 5px; text-align: center; }
         .stat-number { font-size: 24px; font-weight: bold; }
         .stat-label { font-size: 14px; margin-top: 5px; }
+        .stat-detail { font-size: 12px; margin-top: 3px; opacity: 0.8; }
         .section { margin-bottom: 30px; }
         .section h2 { color: #333; border-bottom: 1px solid #ddd; padding-bottom: 5px; }
         .form-group { margin-bottom: 15px; }
@@ -84,13 +178,33 @@ func (ws *WebServer) loadTemplates() {
         .search-box { width: 100%; padding: 10px; margin-bottom: 20px; border: 1px solid #ddd; border-radius: 4px; }
         .hidden { display: none; }
         .edit-form { background: #fff; border: 2px solid #007bff; padding: 15px; border-radius: 5px; }
+        .logout { float: right; }
+        .render-toggle { display: inline-block; margin-left: 10px; font-size: 14px; }
+        .chart-controls { margin-bottom: 10px; }
+        .chart-controls select { padding: 5px; }
+        .history-chart { width: 100%; height: 180px; }
+        .history-chart .bar { fill: #007bff; }
+        .history-chart .axis { font-size: 10px; fill: #666; }
+        .latency-table { border-collapse: collapse; margin-top: 15px; font-size: 14px; }
+        .latency-table th, .latency-table td { border: 1px solid #ddd; padding: 4px 10px; text-align: right; }
+        .latency-table th:first-child, .latency-table td:first-child { text-align: left; }
+        .document-content.plain { white-space: pre-wrap; word-wrap: break-word; }
+        .document-content pre { background: #272822; color: #f8f8f2; padding: 10px; border-radius: 4px; overflow-x: auto; }
+        .document-content code { font-family: monospace; background: #e9ecef; padding: 1px 4px; border-radius: 3px; }
+        .document-content pre code { background: none; padding: 0; }
+        .tok-comment { color: #75715e; }
+        .tok-string { color: #e6db74; }
+        .tok-number { color: #ae81ff; }
+        .tok-keyword { color: #f92672; }
     </style>
 </head>
 <body>
     <div class="container">
         <div class="header">
+            {{if .Auth}}<form method="post" action="/logout" class="logout"><button type="submit" class="btn">Log out</button></form>{{end}}
             <h1>Memory Server Dashboard</h1>
-            <p>Local Memory Layer for Developers</p>
+            <p>Local Memory Layer for Developers · <a href="/api/explorer">API explorer</a> · Export as <a href="/api/export?format=json">JSON</a>, <a href="/api/export?format=jsonl">JSONL</a> or <a href="/api/export?format=csv">CSV</a></p>
+            {{if .Switch}}<p>Database: <code>{{.Database}}</code> · <a href="/databases">Switch database</a></p>{{end}}
         </div>
 
         <div class="stats">
@@ -100,16 +214,36 @@ func (ws *WebServer) loadTemplates() {
             </div>
             <div class="stat-card">
                 <div class="stat-number" id="add-count">0</div>
-                <div class="stat-label">Documents Added</div>
+                <div class="stat-label">Documents Added (all time)</div>
+                <div class="stat-detail" id="add-channels"></div>
             </div>
             <div class="stat-card">
                 <div class="stat-number" id="search-count">0</div>
-                <div class="stat-label">Searches Performed</div>
+                <div class="stat-label">Searches Performed (all time)</div>
+                <div class="stat-detail" id="search-channels"></div>
             </div>
             <div class="stat-card">
                 <div class="stat-number" id="delete-count">0</div>
-                <div class="stat-label">Documents Deleted</div>
+                <div class="stat-label">Documents Deleted (all time)</div>
+                <div class="stat-detail" id="delete-channels"></div>
+            </div>
+        </div>
+
+        <div class="section">
+            <h2>Activity</h2>
+            <div class="chart-controls">
+                <label for="history-operation">Operations per day:</label>
+                <select id="history-operation">
+                    <option value="">All operations</option>
+                    <option value="add_document">Add</option>
+                    <option value="search">Search</option>
+                    <option value="get_context">Get context</option>
+                    <option value="update_document">Update</option>
+                    <option value="delete_document">Delete</option>
+                </select>
             </div>
+            <svg id="history-chart" class="history-chart" role="img" aria-label="Operations per day"></svg>
+            <table id="latency-table" class="latency-table"></table>
         </div>
 
         <div class="section">
@@ -139,8 +273,11 @@ func (ws *WebServer) loadTemplates() {
         <div class="section">
             <h2>Search & Browse Memories</h2>
             <input type="text" id="search-input" class="search-box" placeholder="Search memories...">
-            <button onclick="searchDocuments()" class="btn">Search</button>
-            <button onclick="loadAllDocuments()" class="btn">Show All</button>
+            <button id="search-button" class="btn">Search</button>
+            <button id="show-all-button" class="btn">Show All</button>
+            <label class="render-toggle">
+                <input type="checkbox" id="render-markdown"> Render Markdown
+            </label>
             
             <div id="documents-container">
                 <!-- Documents will be loaded here -->
@@ -171,13 +308,17 @@ func (ws *WebServer) loadTemplates() {
                         <textarea id="edit-properties" name="properties"></textarea>
                     </div>
                     <button type="submit" class="btn btn-success">Save Changes</button>
-                    <button type="button" onclick="cancelEdit()" class="btn">Cancel</button>
+                    <button type="button" id="cancel-edit-button" class="btn">Cancel</button>
                 </form>
             </div>
         </div>
     </div>
 
-    <script>
+    <script type="module" nonce="{{.Nonce}}">
+        // renderMarkdown escapes all text before adding markup; see
+        // web/src/lib/markdown.js, which the app uses too.
+        import { renderMarkdown } from '/classic/markdown.js';
+
         // Load initial data
         loadStats();
         loadAllDocuments();
@@ -216,7 +357,7 @@ func (ws *WebServer) loadTemplates() {
                     loadAllDocuments();
                     alert('Memory added successfully!');
                 } else {
-                    alert('Failed to add memory');
+                    alert('Failed to add memory: ' + await errorMessage(response));
                 }
             } catch (error) {
                 alert('Error: ' + error.message);
@@ -258,26 +399,126 @@ func (ws *WebServer) loadTemplates() {
                     loadAllDocuments();
                     alert('Memory updated successfully!');
                 } else {
-                    alert('Failed to update memory');
+                    alert('Failed to update memory: ' + await errorMessage(response));
                 }
             } catch (error) {
                 alert('Error: ' + error.message);
             }
         });
 
+        // errorMessage extracts the message of an API error response.
+        async function errorMessage(response) {
+            try {
+                const body = await response.json();
+                return body.message || response.statusText;
+            } catch (e) {
+                return response.statusText;
+            }
+        }
+
         async function loadStats() {
             try {
                 const response = await fetch('/api/stats');
                 const stats = await response.json();
                 document.getElementById('total-docs').textContent = stats.total_documents;
-                document.getElementById('add-count').textContent = stats.add_document_count;
-                document.getElementById('search-count').textContent = stats.search_count;
-                document.getElementById('delete-count').textContent = stats.delete_document_count;
+                document.getElementById('add-count').textContent = usageTotal(stats.lifetime_usage, 'add_document');
+                document.getElementById('search-count').textContent = usageTotal(stats.lifetime_usage, 'search');
+                document.getElementById('delete-count').textContent = usageTotal(stats.lifetime_usage, 'delete_document');
+                const since = 'since ' + new Date(stats.started_at).toLocaleString();
+                document.getElementById('add-channels').textContent = stats.add_document_count + ' ' + since + ' · ' + channelBreakdown(stats.usage, 'add_document');
+                document.getElementById('search-channels').textContent = stats.search_count + ' ' + since + ' · ' + channelBreakdown(stats.usage, 'search');
+                document.getElementById('delete-channels').textContent = stats.delete_document_count + ' ' + since + ' · ' + channelBreakdown(stats.usage, 'delete_document');
+                lastStats = stats;
+                drawHistory(stats.history || []);
+                drawLatency(stats.latency || {});
             } catch (error) {
                 console.error('Failed to load stats:', error);
             }
         }
 
+        let lastStats = null;
+
+        // drawHistory renders the per-day counts as an SVG bar chart.
+        function drawHistory(history) {
+            const svgNS = 'http://www.w3.org/2000/svg';
+            const svg = document.getElementById('history-chart');
+            const op = document.getElementById('history-operation').value;
+            const width = svg.clientWidth || 800;
+            const height = 180;
+            const bottom = 20;
+            svg.setAttribute('viewBox', '0 0 ' + width + ' ' + height);
+            svg.replaceChildren();
+
+            const values = history.map(day => op
+                ? (day.counts[op] || 0)
+                : Object.values(day.counts).reduce((sum, n) => sum + n, 0));
+            const max = Math.max(1, ...values);
+            const slot = width / Math.max(1, history.length);
+
+            history.forEach((day, i) => {
+                const barHeight = (height - bottom - 15) * values[i] / max;
+                const bar = document.createElementNS(svgNS, 'rect');
+                bar.setAttribute('class', 'bar');
+                bar.setAttribute('x', i * slot + 2);
+                bar.setAttribute('y', height - bottom - barHeight);
+                bar.setAttribute('width', Math.max(1, slot - 4));
+                bar.setAttribute('height', barHeight);
+                const title = document.createElementNS(svgNS, 'title');
+                title.textContent = day.date + ': ' + values[i];
+                bar.appendChild(title);
+                svg.appendChild(bar);
+
+                if (i % 7 === history.length % 7 || i === history.length - 1) {
+                    const label = document.createElementNS(svgNS, 'text');
+                    label.setAttribute('class', 'axis');
+                    label.setAttribute('x', i * slot + slot / 2);
+                    label.setAttribute('y', height - 5);
+                    label.setAttribute('text-anchor', 'middle');
+                    label.textContent = day.date.slice(5);
+                    svg.appendChild(label);
+                }
+            });
+
+            const peak = document.createElementNS(svgNS, 'text');
+            peak.setAttribute('class', 'axis');
+            peak.setAttribute('x', 2);
+            peak.setAttribute('y', 10);
+            peak.textContent = 'max ' + max;
+            svg.appendChild(peak);
+        }
+
+        function drawLatency(latency) {
+            const table = document.getElementById('latency-table');
+            table.replaceChildren();
+            const phases = Object.keys(latency).sort();
+            if (phases.length === 0) {
+                return;
+            }
+            const header = el('tr');
+            for (const label of ['Latency', 'Count', 'Mean', 'p50', 'p95', 'p99']) {
+                header.appendChild(el('th', '', label));
+            }
+            table.appendChild(header);
+            const ms = value => value.toFixed(value < 1 ? 3 : 1) + ' ms';
+            for (const phase of phases) {
+                const s = latency[phase];
+                const row = el('tr');
+                for (const cell of [phase, String(s.count), ms(s.mean_ms), ms(s.p50_ms), ms(s.p95_ms), ms(s.p99_ms)]) {
+                    row.appendChild(el('td', '', cell));
+                }
+                table.appendChild(row);
+            }
+        }
+
+        function usageTotal(usage, op) {
+            return Object.values((usage && usage[op]) || {}).reduce((sum, n) => sum + n, 0);
+        }
+
+        function channelBreakdown(usage, op) {
+            const byChannel = (usage && usage[op]) || {};
+            return 'MCP ' + (byChannel.mcp || 0) + ' / REST ' + (byChannel.rest || 0);
+        }
+
         async function loadAllDocuments() {
             try {
                 const response = await fetch('/api/documents');
@@ -304,39 +545,108 @@ func (ws *WebServer) loadTemplates() {
             }
         }
 
+        // Memory content is untrusted (agents store snippets from web pages),
+        // so documents are built from DOM nodes and text is only ever
+        // assigned via textContent, except for renderMarkdown's output,
+        // which escapes everything it does not generate itself.
+        let shownDocuments = [];
+
         function displayDocuments(documents) {
+            shownDocuments = documents;
             const container = document.getElementById('documents-container');
+            container.replaceChildren();
             if (documents.length === 0) {
-                container.innerHTML = '<p>No documents found.</p>';
+                container.appendChild(el('p', '', 'No documents found.'));
                 return;
             }
 
-            container.innerHTML = documents.map(doc => {
-                const tags = doc.tags ? doc.tags.map(tag => '<span class="tag">' + tag + '</span>').join('') : '';
-                const favorite = doc.favorite ? '<span class="favorite-star">⭐</span>' : '';
+            const markdown = document.getElementById('render-markdown').checked;
+            for (const doc of documents) {
+                const card = el('div', 'document' + (doc.favorite ? ' favorite' : ''));
+
+                const header = el('div', 'document-header');
+                header.appendChild(el('div', 'document-id', 'ID: ' + doc.id));
+                const star = el('div');
+                if (doc.favorite) {
+                    star.appendChild(el('span', 'favorite-star', '⭐'));
+                }
+                header.appendChild(star);
+                card.appendChild(header);
+
+                if (doc.properties && doc.properties.title) {
+                    card.appendChild(el('strong', '', doc.properties.title));
+                }
+                const content = el('div', 'document-content' + (markdown ? '' : ' plain'));
+                if (markdown) {
+                    content.innerHTML = renderMarkdown(doc.content);
+                } else {
+                    content.textContent = doc.content;
+                }
+                card.appendChild(content);
+
+                const tags = el('div', 'tags');
+                for (const tag of doc.tags || []) {
+                    tags.appendChild(el('span', 'tag', tag));
+                }
+                card.appendChild(tags);
+
+                const source = formatProvenance(doc.provenance);
                 const createdAt = new Date(doc.created_at).toLocaleString();
-                
-                return '<div class="document' + (doc.favorite ? ' favorite' : '') + '">' +
-                    '<div class="document-header">' +
-                        '<div class="document-id">ID: ' + doc.id + '</div>' +
-                        '<div>' + favorite + '</div>' +
-                    '</div>' +
-                    '<div class="document-content">' + doc.content + '</div>' +
-                    '<div class="tags">' + tags + '</div>' +
-                    '<div class="document-meta">Created: ' + createdAt + '</div>' +
-                    '<div style="margin-top: 10px;">' +
-                        '<button onclick="editDocument(\'' + doc.id + '\')" class="btn">Edit</button>' +
-                        '<button onclick="toggleFavorite(\'' + doc.id + '\', ' + !doc.favorite + ')" class="btn">' + 
-                            (doc.favorite ? 'Remove Favorite' : 'Add Favorite') + '</button>' +
-                        '<button onclick="deleteDocument(\'' + doc.id + '\')" class="btn btn-danger">Delete</button>' +
-                    '</div>' +
-                '</div>';
-            }).join('');
+                card.appendChild(el('div', 'document-meta', 'Created: ' + createdAt + (source ? ' · Source: ' + source : '')));
+
+                const actions = el('div');
+                actions.style.marginTop = '10px';
+                actions.appendChild(button('Edit', 'btn', () => editDocument(doc.id)));
+                actions.appendChild(button(doc.favorite ? 'Remove Favorite' : 'Add Favorite', 'btn', () => toggleFavorite(doc.id, !doc.favorite)));
+                actions.appendChild(button('Delete', 'btn btn-danger', () => deleteDocument(doc.id)));
+                card.appendChild(actions);
+
+                container.appendChild(card);
+            }
+        }
+
+        function el(tag, className, text) {
+            const node = document.createElement(tag);
+            if (className) {
+                node.className = className;
+            }
+            if (text !== undefined) {
+                node.textContent = text;
+            }
+            return node;
+        }
+
+        function button(label, className, onClick) {
+            const node = el('button', className, label);
+            node.addEventListener('click', onClick);
+            return node;
+        }
+
+        function formatProvenance(p) {
+            if (!p) {
+                return '';
+            }
+            const parts = [];
+            if (p.client) {
+                parts.push(p.client + (p.client_version ? ' ' + p.client_version : ''));
+            }
+            if (p.source_repo) {
+                parts.push(p.source_repo + (p.source_commit ? '@' + p.source_commit : ''));
+            } else if (p.source_commit) {
+                parts.push(p.source_commit);
+            }
+            if (p.source_file) {
+                parts.push(p.source_file);
+            }
+            return parts.join(' · ');
         }
 
         async function editDocument(id) {
             try {
                 const response = await fetch('/api/documents/' + id);
+                if (!response.ok) {
+                    throw new Error(await errorMessage(response));
+                }
                 const doc = await response.json();
                 
                 document.getElementById('edit-id').value = doc.id;
@@ -347,7 +657,7 @@ func (ws *WebServer) loadTemplates() {
                 
                 document.getElementById('edit-modal').classList.remove('hidden');
             } catch (error) {
-                alert('Failed to load document for editing');
+                alert('Failed to load document for editing: ' + error.message);
             }
         }
 
@@ -366,7 +676,7 @@ func (ws *WebServer) loadTemplates() {
                 if (response.ok) {
                     loadAllDocuments();
                 } else {
-                    alert('Failed to update favorite status');
+                    alert('Failed to update favorite status: ' + await errorMessage(response));
                 }
             } catch (error) {
                 alert('Error: ' + error.message);
@@ -388,13 +698,29 @@ func (ws *WebServer) loadTemplates() {
                     loadAllDocuments();
                     alert('Memory deleted successfully!');
                 } else {
-                    alert('Failed to delete memory');
+                    alert('Failed to delete memory: ' + await errorMessage(response));
                 }
             } catch (error) {
                 alert('Error: ' + error.message);
             }
         }
 
+        document.getElementById('search-button').addEventListener('click', searchDocuments);
+        document.getElementById('history-operation').addEventListener('change', () => {
+            if (lastStats) {
+                drawHistory(lastStats.history || []);
+            }
+        });
+        document.getElementById('show-all-button').addEventListener('click', loadAllDocuments);
+        document.getElementById('cancel-edit-button').addEventListener('click', cancelEdit);
+
+        const renderToggle = document.getElementById('render-markdown');
+        renderToggle.checked = localStorage.getItem('renderMarkdown') !== 'false';
+        renderToggle.addEventListener('change', () => {
+            localStorage.setItem('renderMarkdown', renderToggle.checked);
+            displayDocuments(shownDocuments);
+        });
+
         // Search on Enter key
         document.getElementById('search-input').addEventListener('keypress', (e) => {
             if (e.key === 'Enter') {
@@ -410,28 +736,299 @@ func (ws *WebServer) loadTemplates() {
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to parse HTML template")
 	}
+
+	loginHTML := `
+<!DOCTYPE html>
+<html>
+<head>
+    <title>Memory Server - Log in</title>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <style>
+        body { font-family: Arial, sans-serif; margin: 20px; background-color: #f5f5f5; }
+        .container { max-width: 400px; margin: 80px auto; background: white; padding: 20px; border-radius: 8px; box-shadow: 0 2px 4px rgba(0,0,0,0.1); }
+        input { width: 100%; padding: 8px; border: 1px solid #ddd; border-radius: 4px; box-sizing: border-box; margin-bottom: 15px; font-family: monospace; }
+        .btn { background: #007bff; color: white; padding: 10px 20px; border: none; border-radius: 4px; cursor: pointer; }
+        .error { color: #dc3545; }
+        .hint { font-size: 12px; color: #666; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <h1>Memory Server</h1>
+        {{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+        <form method="post" action="/login">
+            <label for="token">API token:</label>
+            <input type="password" id="token" name="token" autocomplete="current-password" autofocus required>
+            <button type="submit" class="btn">Log in</button>
+        </form>
+        <p class="hint">A token was printed when the server was first started with authentication enabled.</p>
+    </div>
+</body>
+</html>`
+
+	ws.login, err = template.New("login").Parse(loginHTML)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse login template")
+	}
+
+	ws.explorer, err = template.New("explorer").Parse(explorerHTML)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse API explorer template")
+	}
+
+	ws.picker, err = template.New("databases").Parse(databasesHTML)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse database picker template")
+	}
 }
 
 func (ws *WebServer) Start(port int) error {
-	http.HandleFunc("/", ws.handleIndex)
-	http.HandleFunc("/api/stats", ws.handleStats)
-	http.HandleFunc("/api/documents", ws.handleDocuments)
-	http.HandleFunc("/api/documents/", ws.handleDocumentByID)
-	http.HandleFunc("/api/search", ws.handleSearch)
+	return ws.Run(context.Background(), port)
+}
+
+// Timeouts of the web server. Requests only touch the local store, so
+// anything slower than this is a stuck or malicious client.
+const (
+	webReadHeaderTimeout = 5 * time.Second
+	webReadTimeout       = 30 * time.Second
+	webWriteTimeout      = 60 * time.Second
+	webIdleTimeout       = 2 * time.Minute
+)
+
+// Run serves the dashboard and REST API until ctx is cancelled. Shutdown
+// waits for in-flight requests to finish and then flushes the store, so an
+// interrupt never cuts a write short. A store opened by the database picker
+// is closed as well.
+func (ws *WebServer) Run(ctx context.Context, port int) error {
+	host := ws.opts.Host
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	log.Info().Str("addr", addr).Bool("auth", ws.opts.Tokens != nil).Msg("Starting web server")
+	err := serveHTTP(ctx, &http.Server{
+		Addr:              addr,
+		Handler:           ws.Handler(),
+		ReadHeaderTimeout: webReadHeaderTimeout,
+		ReadTimeout:       webReadTimeout,
+		WriteTimeout:      webWriteTimeout,
+		IdleTimeout:       webIdleTimeout,
+	})
+	ws.closing.Wait()
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.store != nil {
+		if ws.ownsStore {
+			if cerr := ws.store.Close(); cerr != nil {
+				log.Error().Err(cerr).Msg("Failed to close memory store")
+			}
+		} else {
+			ws.store.Flush()
+		}
+	}
+	return err
+}
+
+// Handler returns the dashboard and REST API on a mux of their own, so that
+// the web server can be mounted elsewhere or tested with httptest. Every
+// request is assigned a request ID, see withRequestID, and cross-site
+// requests are refused, see checkOrigin.
+func (ws *WebServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	for _, route := range ws.routes() {
+		mux.HandleFunc(route.Pattern, route.Handler)
+	}
+	return withRequestID(checkOrigin(mux))
+}
+
+// webRoute is a pattern served by Handler. Every API route must be
+// described by apiOperations, which a test checks; pages are not.
+type webRoute struct {
+	Pattern string
+	Handler http.HandlerFunc
+	Page    bool
+}
+
+// routes lists the patterns served by Handler.
+func (ws *WebServer) routes() []webRoute {
+	routes := []webRoute{
+		{"/", ws.protect(ws.handleIndex), true},
+		{classicPath, ws.protect(ws.handleClassic), true},
+		{markdownScriptPath, ws.protect(ws.handleMarkdownScript), true},
+		{"/login", ws.handleLogin, true},
+		{"/logout", ws.handleLogout, true},
+		{explorerPath, ws.protect(ws.handleExplorer), true},
+		{"/api/stats", ws.protect(ws.withStore(ws.handleStats)), false},
+		{"/api/documents", ws.protect(ws.withStore(ws.handleDocuments)), false},
+		{"/api/documents/", ws.protect(ws.withStore(ws.handleDocumentByID)), false},
+		{"/api/search", ws.protect(ws.withStore(ws.handleSearch)), false},
+		{"/api/context", ws.protect(ws.withStore(ws.handleContext)), false},
+		{"/api/export", ws.protect(ws.withStore(ws.handleExport)), false},
+		{"/api/import", ws.protect(ws.withStore(ws.handleImport)), false},
+		{"/metrics", ws.protect(ws.withStore(ws.handleMetrics)), false},
+		{"/api/openapi.json", ws.protect(ws.handleOpenAPI), false},
+	}
+	if ws.switchesDatabases() {
+		routes = append(routes,
+			webRoute{databasesPath, ws.protect(ws.handleDatabasePicker), true},
+			webRoute{"/api/databases", ws.protect(ws.handleDatabases), false},
+			webRoute{"/api/databases/current", ws.protect(ws.handleCurrentDatabase), false},
+		)
+	}
+	return routes
+}
+
+// checkOrigin refuses requests that a page on another site may have sent
+// through the browser, whether or not authentication is enabled, so that
+// visiting a web page cannot change memories or switch databases. See
+// checkRequestOrigin.
+func checkOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := checkRequestOrigin(r, false); err != nil {
+			zerolog.Ctx(r.Context()).Warn().Err(err).Str("remote", r.RemoteAddr).Msg("Refused cross-site request")
+			writeError(w, r, http.StatusForbidden, codeForbidden, "Cross-site request refused: "+err.Error(), nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// protect requires a bearer token or a dashboard session for next when
+// authentication is enabled. Browsers asking for a page rather than the API
+// (the dashboard and its routes, the API explorer or the database picker)
+// are sent to the login page instead.
+func (ws *WebServer) protect(next http.HandlerFunc) http.HandlerFunc {
+	if ws.opts.Tokens == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ws.opts.Tokens.authenticated(r, true) {
+			next(w, r)
+			return
+		}
+		if isPage(r.URL.Path) {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="memory-server"`)
+		writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "Pass an API token as 'Authorization: Bearer <token>'", nil)
+	}
+}
+
+// isPage reports whether path is a page for browsers rather than an API or
+// metrics endpoint.
+func isPage(path string) bool {
+	if path == explorerPath {
+		return true
+	}
+	return !strings.HasPrefix(path, "/api/") && path != "/metrics"
+}
+
+func (ws *WebServer) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if ws.opts.Tokens == nil {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	var data struct{ Error string }
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		id, ok := ws.opts.Tokens.startSession(strings.TrimSpace(r.PostFormValue("token")))
+		if ok {
+			http.SetCookie(w, &http.Cookie{
+				Name:     sessionCookie,
+				Value:    id,
+				Path:     "/",
+				MaxAge:   int(sessionLifetime.Seconds()),
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteStrictMode,
+			})
+			log.Info().Str("remote", r.RemoteAddr).Msg("Dashboard login")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		log.Warn().Str("remote", r.RemoteAddr).Msg("Failed dashboard login")
+		w.WriteHeader(http.StatusUnauthorized)
+		data.Error = "Invalid token."
+	default:
+		writeMethodNotAllowed(w, r)
+		return
+	}
 
-	addr := fmt.Sprintf(":%d", port)
-	log.Info().Str("addr", addr).Msg("Starting web server")
-	return http.ListenAndServe(addr, nil)
+	w.Header().Set("Content-Type", "text/html")
+	if err := ws.login.Execute(w, data); err != nil {
+		log.Error().Err(err).Msg("Failed to execute login template")
+	}
 }
 
+func (ws *WebServer) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+	if c, err := r.Cookie(sessionCookie); err == nil && ws.opts.Tokens != nil {
+		ws.opts.Tokens.endSession(c.Value)
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1, HttpOnly: true})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// handleIndex serves the dashboard app, or the inline dashboard if the app
+// has not been built.
 func (ws *WebServer) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if ws.app != nil {
+		ws.serveApp(w, r)
+		return
+	}
 	if r.URL.Path != "/" {
-		http.NotFound(w, r)
+		writeError(w, r, http.StatusNotFound, codeNotFound, "No such page or endpoint: "+r.URL.Path, nil)
+		return
+	}
+	ws.handleClassic(w, r)
+}
+
+// handleClassic serves the inline dashboard.
+func (ws *WebServer) handleClassic(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+	if ws.Store() == nil {
+		http.Redirect(w, r, databasesPath, http.StatusSeeOther)
+		return
+	}
+	ws.renderPage(w, r, ws.templates)
+}
+
+// renderPage executes a page template with a fresh Content Security Policy
+// nonce. Inline scripts only run with this request's nonce, so markup that
+// slips into rendered memories cannot execute.
+func (ws *WebServer) renderPage(w http.ResponseWriter, r *http.Request, page *template.Template) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		log.Error().Err(err).Msg("Failed to generate CSP nonce")
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
-	
+	data := struct {
+		Nonce    string
+		Auth     bool
+		Switch   bool
+		Database string
+	}{
+		Nonce:  base64.StdEncoding.EncodeToString(nonce),
+		Auth:   ws.opts.Tokens != nil,
+		Switch: ws.switchesDatabases(),
+	}
+	if store := ws.Store(); store != nil {
+		data.Database = store.Path()
+	}
+	w.Header().Set("Content-Security-Policy", contentSecurityPolicy("'nonce-"+data.Nonce+"'"))
 	w.Header().Set("Content-Type", "text/html")
-	if err := ws.templates.Execute(w, nil); err != nil {
+	if err := page.Execute(w, data); err != nil {
 		log.Error().Err(err).Msg("Failed to execute template")
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 	}
@@ -439,67 +1036,94 @@ func (ws *WebServer) handleIndex(w http.ResponseWriter, r *http.Request) {
 
 func (ws *WebServer) handleStats(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, r)
 		return
 	}
 
-	docs, err := ws.store.ListDocuments()
+	count, err := storeOf(r).Count()
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to get document count")
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		writeStoreError(w, r, err, "Failed to get document count")
+		return
+	}
+
+	stats := StatsResponse{
+		TotalDocuments:      count,
+		AddDocumentCount:    ws.stats.Total(OpAddDocument),
+		SearchCount:         ws.stats.Total(OpSearch),
+		DeleteDocumentCount: ws.stats.Total(OpDeleteDocument),
+		GetDocumentCount:    ws.stats.Total(OpGetDocument),
+		GetAllDocuments:     ws.stats.Total(OpGetAllDocuments),
+		UpdateDocumentCount: ws.stats.Total(OpUpdateDocument),
+		Usage:               ws.stats.Snapshot(),
+		LifetimeUsage:       ws.stats.Lifetime(),
+		StartedAt:           ws.stats.StartedAt(),
+		History:             ws.stats.History(),
+		Latency:             storeOf(r).Latency().Summary(),
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// handleMetrics serves the counters and latency histograms in the Prometheus
+// text format.
+func (ws *WebServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r)
 		return
 	}
 
-	stats := map[string]interface{}{
-		"total_documents":      len(docs),
-		"add_document_count":   ws.stats.AddDocumentCount,
-		"search_count":         ws.stats.SearchCount,
-		"delete_document_count": ws.stats.DeleteDocumentCount,
-		"get_document_count":   ws.stats.GetDocumentCount,
-		"get_all_documents":    ws.stats.GetAllDocuments,
+	count, err := storeOf(r).Count()
+	if err != nil {
+		writeStoreError(w, r, err, "Failed to get document count")
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(stats)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := WritePrometheus(w, ws.stats, storeOf(r).Latency(), count); err != nil {
+		log.Error().Err(err).Msg("Failed to write metrics")
+	}
 }
 
 func (ws *WebServer) handleDocuments(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		ws.stats.GetAllDocuments++
-		docs, err := ws.store.ListDocuments()
+		ws.stats.Record(OpGetAllDocuments, ChannelREST)
+		docs, err := storeOf(r).ListDocuments()
 		if err != nil {
-			log.Error().Err(err).Msg("Failed to list documents")
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			writeStoreError(w, r, err, "Failed to list documents")
 			return
 		}
-		
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(docs)
+
+		writeJSON(w, http.StatusOK, docs)
 
 	case http.MethodPost:
 		var doc Document
-		if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		if !decodeJSON(w, r, &doc) {
 			return
 		}
-		
-		doc.ID = uuid.New().String()
+
+		// Callers may choose the ID; CreateDocument refuses to reuse one
+		if doc.ID == "" {
+			doc.ID = uuid.New().String()
+		}
 		doc.CreatedAt = time.Now()
-		
-		if err := ws.store.AddDocument(doc); err != nil {
-			log.Error().Err(err).Msg("Failed to add document")
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		// Only the source fields may be supplied by the caller
+		doc.Provenance.Client = WebClient
+		doc.Provenance.ClientVersion = ""
+		doc.Provenance.SessionID = ""
+
+		if err := storeOf(r).CreateDocument(doc); err != nil {
+			writeStoreError(w, r, err, "Failed to add document")
 			return
 		}
-		
-		ws.stats.AddDocumentCount++
-		
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"id": doc.ID, "status": "created"})
+
+		ws.stats.Record(OpAddDocument, ChannelREST)
+
+		w.Header().Set("Location", "/api/documents/"+url.PathEscape(doc.ID))
+		writeJSON(w, http.StatusCreated, DocumentStatus{ID: doc.ID, Status: "created"})
 
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, r)
 	}
 }
 
@@ -508,12 +1132,12 @@ func (ws *WebServer) handleDocumentByID(w http.ResponseWriter, r *http.Request)
 	path := strings.TrimPrefix(r.URL.Path, "/api/documents/")
 	parts := strings.Split(path, "/")
 	if len(parts) == 0 || parts[0] == "" {
-		http.Error(w, "Document ID required", http.StatusBadRequest)
+		writeError(w, r, http.StatusNotFound, codeNotFound, "Document ID required", nil)
 		return
 	}
-	
+
 	id := parts[0]
-	
+
 	// Handle favorite toggle endpoint
 	if len(parts) > 1 && parts[1] == "favorite" {
 		ws.handleToggleFavorite(w, r, id)
@@ -522,163 +1146,312 @@ func (ws *WebServer) handleDocumentByID(w http.ResponseWriter, r *http.Request)
 
 	switch r.Method {
 	case http.MethodGet:
-		ws.stats.GetDocumentCount++
-		docs, err := ws.store.ListDocuments()
+		ws.stats.Record(OpGetDocument, ChannelREST)
+		doc, err := storeOf(r).GetDocument(id)
 		if err != nil {
-			log.Error().Err(err).Msg("Failed to list documents")
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			writeStoreError(w, r, err, "Failed to get document")
 			return
 		}
-		
-		for _, doc := range docs {
-			if doc.ID == id {
-				w.Header().Set("Content-Type", "application/json")
-				json.NewEncoder(w).Encode(doc)
-				return
-			}
-		}
-		
-		http.Error(w, "Document not found", http.StatusNotFound)
+
+		writeJSON(w, http.StatusOK, doc)
 
 	case "PUT":
 		var updateDoc Document
-		if err := json.NewDecoder(r.Body).Decode(&updateDoc); err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		if !decodeJSON(w, r, &updateDoc) {
 			return
 		}
-		
-		// First delete the old document
-		if err := ws.store.DeleteDocument(id); err != nil {
-			log.Error().Err(err).Str("id", id).Msg("Failed to delete document for update")
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+
+		existing, err := storeOf(r).GetDocument(id)
+		if err != nil {
+			writeStoreError(w, r, err, "Failed to get document for update")
 			return
 		}
-		
-		// Then add the updated document with the same ID
+
+		// Replace the document under the same ID, re-embedding its content
 		updateDoc.ID = id
 		updateDoc.CreatedAt = time.Now() // Update timestamp
-		
-		if err := ws.store.AddDocument(updateDoc); err != nil {
-			log.Error().Err(err).Msg("Failed to update document")
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		updateDoc.Provenance = existing.Provenance
+
+		if err := storeOf(r).UpdateDocument(updateDoc); err != nil {
+			writeStoreError(w, r, err, "Failed to update document")
 			return
 		}
-		
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"id": id, "status": "updated"})
+
+		ws.stats.Record(OpUpdateDocument, ChannelREST)
+
+		writeJSON(w, http.StatusOK, DocumentStatus{ID: id, Status: "updated"})
 
 	case http.MethodDelete:
-		if err := ws.store.DeleteDocument(id); err != nil {
-			log.Error().Err(err).Str("id", id).Msg("Failed to delete document")
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		if err := storeOf(r).DeleteDocument(id); err != nil {
+			writeStoreError(w, r, err, "Failed to delete document")
 			return
 		}
-		
-		ws.stats.DeleteDocumentCount++
-		
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"id": id, "status": "deleted"})
+
+		ws.stats.Record(OpDeleteDocument, ChannelREST)
+
+		writeJSON(w, http.StatusOK, DocumentStatus{ID: id, Status: "deleted"})
 
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, r)
 	}
 }
 
 func (ws *WebServer) handleToggleFavorite(w http.ResponseWriter, r *http.Request, id string) {
 	if r.Method != "PUT" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, r)
 		return
 	}
 
-	var req struct {
-		Favorite bool `json:"favorite"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	var req FavoriteRequest
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
 	// Get the current document
-	docs, err := ws.store.ListDocuments()
+	currentDoc, err := storeOf(r).GetDocument(id)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to list documents")
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-
-	var currentDoc *Document
-	for _, doc := range docs {
-		if doc.ID == id {
-			currentDoc = &doc
-			break
-		}
-	}
-
-	if currentDoc == nil {
-		http.Error(w, "Document not found", http.StatusNotFound)
+		writeStoreError(w, r, err, "Failed to get document")
 		return
 	}
 
 	// Update favorite status
 	currentDoc.Favorite = req.Favorite
 
-	// Delete and re-add with updated favorite status
-	if err := ws.store.DeleteDocument(id); err != nil {
-		log.Error().Err(err).Str("id", id).Msg("Failed to delete document for favorite update")
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	// Re-add with updated favorite status
+	if err := storeOf(r).UpdateDocument(currentDoc); err != nil {
+		writeStoreError(w, r, err, "Failed to update document favorite status")
 		return
 	}
 
-	if err := ws.store.AddDocument(*currentDoc); err != nil {
-		log.Error().Err(err).Msg("Failed to update document favorite status")
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
+	ws.stats.Record(OpUpdateDocument, ChannelREST)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"id":       id,
-		"favorite": req.Favorite,
-		"status":   "updated",
-	})
+	writeJSON(w, http.StatusOK, DocumentStatus{ID: id, Status: "updated", Favorite: &req.Favorite})
 }
 
 func (ws *WebServer) handleSearch(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, r)
 		return
 	}
 
 	query := r.URL.Query().Get("q")
 	if query == "" {
-		http.Error(w, "Query parameter 'q' is required", http.StatusBadRequest)
+		writeInvalidParam(w, r, "q", "Query parameter 'q' is required")
 		return
 	}
 
 	limitStr := r.URL.Query().Get("limit")
 	limit := 10
 	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
-			limit = l
+		l, err := strconv.Atoi(limitStr)
+		if err != nil || l <= 0 || l > maxSearchLimit {
+			writeInvalidParam(w, r, "limit", fmt.Sprintf("Query parameter 'limit' must be an integer between 1 and %d", maxSearchLimit))
+			return
 		}
+		limit = l
 	}
 
 	thresholdStr := r.URL.Query().Get("threshold")
 	threshold := float32(0.1)
 	if thresholdStr != "" {
-		if t, err := strconv.ParseFloat(thresholdStr, 32); err == nil && t >= 0 && t <= 1 {
-			threshold = float32(t)
+		t, err := strconv.ParseFloat(thresholdStr, 32)
+		if err != nil || t < 0 || t > 1 {
+			writeInvalidParam(w, r, "threshold", "Query parameter 'threshold' must be a number between 0 and 1")
+			return
 		}
+		threshold = float32(t)
 	}
 
-	ws.stats.SearchCount++
-	docs, err := ws.store.SearchDocuments(query, limit, threshold)
+	ws.stats.Record(OpSearch, ChannelREST)
+	docs, err := storeOf(r).SearchDocuments(query, limit, threshold, queryFilter(r))
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to search documents")
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		writeStoreError(w, r, err, "Failed to search documents")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, docs)
+}
+
+func (ws *WebServer) handleContext(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		writeInvalidParam(w, r, "q", "Query parameter 'q' is required")
+		return
+	}
+
+	budget := DefaultTokenBudget
+	if budgetStr := r.URL.Query().Get("token_budget"); budgetStr != "" {
+		b, err := strconv.Atoi(budgetStr)
+		if err != nil || b < MinTokenBudget || b > MaxTokenBudget {
+			writeInvalidParam(w, r, "token_budget", fmt.Sprintf("Query parameter 'token_budget' must be an integer between %d and %d", MinTokenBudget, MaxTokenBudget))
+			return
+		}
+		budget = b
+	}
+
+	filter := DocumentFilter{Tag: r.URL.Query().Get("tag")}
+	if namespace := r.URL.Query().Get("namespace"); namespace != "" {
+		filter.Properties = map[string]string{NamespaceProperty: namespace}
+	}
+
+	ws.stats.Record(OpGetContext, ChannelREST)
+	bundle, err := storeOf(r).PackContext(query, budget, filter)
+	if err != nil {
+		writeStoreError(w, r, err, "Failed to pack context")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, bundle)
+}
+
+// queryFilter reads the tag, namespace and provenance filters shared by
+// search and export from the query string.
+func queryFilter(r *http.Request) DocumentFilter {
+	filter := DocumentFilter{
+		Tag: r.URL.Query().Get("tag"),
+		Provenance: Provenance{
+			Client:     r.URL.Query().Get("client"),
+			SourceRepo: r.URL.Query().Get("source_repo"),
+			SourceFile: r.URL.Query().Get("source_file"),
+		},
+	}
+	if namespace := r.URL.Query().Get("namespace"); namespace != "" {
+		filter.Properties = map[string]string{NamespaceProperty: namespace}
+	}
+	return filter
+}
+
+// handleExport streams the documents matching the query filters as JSON,
+// JSONL or CSV.
+func (ws *WebServer) handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+
+	format := FormatJSON
+	if name := r.URL.Query().Get("format"); name != "" {
+		f, err := ParseFormat(name)
+		if err != nil {
+			writeInvalidParam(w, r, "format", "Query parameter 'format' must be json, jsonl or csv")
+			return
+		}
+		format = f
+	}
+
+	ws.stats.Record(OpExport, ChannelREST)
+	selection, err := selectExport(storeOf(r), queryFilter(r))
+	if err != nil {
+		writeStoreError(w, r, err, "Failed to list documents for export")
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"memories-%s.%s\"", time.Now().Format("20060102"), format))
+	// Send each page as it is written and give the next one a fresh write
+	// timeout, so that large exports are not cut off
+	rc := http.NewResponseController(w)
+	afterPage := func() error {
+		if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		return extendDeadlines(rc)
+	}
+	if _, err := selection.write(storeOf(r), w, format, afterPage); err != nil {
+		// The status has been sent already; the client sees a truncated body
+		zerolog.Ctx(r.Context()).Error().Err(err).Msg("Failed to write export")
+	}
+}
+
+// extendDeadlines gives a long-running request the server's read and write
+// timeouts afresh, so that it is only cut off if it stalls. Writers without
+// deadlines, such as httptest.ResponseRecorder, are left alone.
+func extendDeadlines(rc *http.ResponseController) error {
+	now := time.Now()
+	if err := rc.SetReadDeadline(now.Add(webReadTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	if err := rc.SetWriteDeadline(now.Add(webWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+
+// handleImport stores the documents in the request body. The format is
+// taken from the format parameter or else the Content-Type. The body may be
+// up to maxImportSize bytes; since every row is embedded, the timeouts are
+// extended after each one.
+func (ws *WebServer) handleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+
+	name := r.URL.Query().Get("format")
+	if name == "" {
+		name = importFormats[mediaType(r.Header.Get("Content-Type"))]
+	}
+	format, err := ParseFormat(name)
+	if err != nil {
+		writeInvalidParam(w, r, "format", "Pass format=json, jsonl or csv, or a matching Content-Type")
+		return
+	}
+	var replace bool
+	if value := r.URL.Query().Get("replace"); value != "" {
+		if replace, err = strconv.ParseBool(value); err != nil {
+			writeInvalidParam(w, r, "replace", "Query parameter 'replace' must be true or false")
+			return
+		}
+	}
+
+	ws.stats.Record(OpImport, ChannelREST)
+	body := http.MaxBytesReader(w, r.Body, maxImportSize)
+	rc := http.NewResponseController(w)
+	report, err := ImportDocuments(storeOf(r), body, format, ImportOptions{
+		Replace:              replace,
+		Client:               WebClient,
+		OnlySourceProvenance: true,
+		AfterRow: func() {
+			if err := extendDeadlines(rc); err != nil {
+				zerolog.Ctx(r.Context()).Warn().Err(err).Msg("Failed to extend import deadlines")
+			}
+		},
+	})
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		// Rows before the limit have been imported
+		writeError(w, r, http.StatusRequestEntityTooLarge, codeTooLarge,
+			fmt.Sprintf("Import is larger than %d bytes: split it into several requests", tooLarge.Limit), report)
+		return
+	} else if errors.Is(err, ErrMalformedInput) {
+		// Rows before the malformed part have been imported
+		writeError(w, r, http.StatusBadRequest, codeInvalidInput, err.Error(), report)
+		return
+	} else if err != nil {
+		writeStoreError(w, r, err, "Failed to import documents")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(docs)
-}
\ No newline at end of file
+	writeJSON(w, http.StatusOK, report)
+}
+
+// importFormats maps request media types to import formats.
+var importFormats = map[string]string{
+	"application/json":     "json",
+	"application/x-ndjson": "jsonl",
+	"application/jsonl":    "jsonl",
+	"text/csv":             "csv",
+}
+
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return mt
+}
@@ -0,0 +1,751 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestMain(m *testing.M) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	os.Exit(m.Run())
+}
+
+// newTestWebServer returns a web server on a fresh store, with the inline
+// dashboard rather than a build of the app.
+func newTestWebServer(t *testing.T, opts WebServerOptions) (*WebServer, *MemoryStore) {
+	t.Helper()
+	store, err := NewMemoryStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws := NewWebServer(store, NewUsageStats(), &opts)
+	ws.app = nil
+	return ws, store
+}
+
+func serve(h http.Handler, method, target, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, values := range header {
+		for _, v := range values {
+			req.Header.Add(k, v)
+		}
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeError(t *testing.T, rec *httptest.ResponseRecorder) APIError {
+	t.Helper()
+	var apiErr APIError
+	if err := json.NewDecoder(rec.Body).Decode(&apiErr); err != nil {
+		t.Fatalf("error body is not JSON: %v", err)
+	}
+	if apiErr.RequestID == "" || apiErr.RequestID != rec.Header().Get(requestIDHeader) {
+		t.Errorf("request ID %q does not match header %q", apiErr.RequestID, rec.Header().Get(requestIDHeader))
+	}
+	return apiErr
+}
+
+func TestHandlerRouting(t *testing.T) {
+	ws, store := newTestWebServer(t, WebServerOptions{})
+	if err := store.AddDocument(Document{ID: "doc-1", Content: "routing test memory", CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	h := ws.Handler()
+
+	tests := []struct {
+		method, target, body string
+		status               int
+		code                 string
+	}{
+		{"GET", "/", "", http.StatusOK, ""},
+		{"GET", classicPath, "", http.StatusOK, ""},
+		{"GET", markdownScriptPath, "", http.StatusOK, ""},
+		{"POST", markdownScriptPath, "", http.StatusMethodNotAllowed, codeMethodNotAllowed},
+		{"GET", "/nope", "", http.StatusNotFound, codeNotFound},
+		{"GET", "/api/nope", "", http.StatusNotFound, codeNotFound},
+		{"GET", "/api/stats", "", http.StatusOK, ""},
+		{"DELETE", "/api/stats", "", http.StatusMethodNotAllowed, codeMethodNotAllowed},
+		{"GET", "/api/documents", "", http.StatusOK, ""},
+		{"POST", "/api/documents", `{"content":"new memory"}`, http.StatusCreated, ""},
+		{"POST", "/api/documents", `{"content":`, http.StatusBadRequest, codeInvalidJSON},
+		{"POST", "/api/documents", `{"content":" "}`, http.StatusUnprocessableEntity, codeValidationFailed},
+		{"POST", "/api/documents", `{"id":"doc-1","content":"taken"}`, http.StatusConflict, codeConflict},
+		{"GET", "/api/documents/doc-1", "", http.StatusOK, ""},
+		{"GET", "/api/documents/missing", "", http.StatusNotFound, codeNotFound},
+		{"PUT", "/api/documents/doc-1/favorite", `{"favorite":true}`, http.StatusOK, ""},
+		{"GET", "/api/search?q=routing", "", http.StatusOK, ""},
+		{"GET", "/api/search", "", http.StatusUnprocessableEntity, codeValidationFailed},
+		{"GET", "/api/search?q=routing&limit=100", "", http.StatusOK, ""},
+		{"GET", "/api/search?q=routing&limit=101", "", http.StatusUnprocessableEntity, codeValidationFailed},
+		{"GET", "/api/context?q=routing", "", http.StatusOK, ""},
+		{"GET", "/api/context?q=routing&token_budget=100001", "", http.StatusUnprocessableEntity, codeValidationFailed},
+		{"GET", "/api/export", "", http.StatusOK, ""},
+		{"GET", "/api/openapi.json", "", http.StatusOK, ""},
+		{"GET", explorerPath, "", http.StatusOK, ""},
+		{"GET", "/metrics", "", http.StatusOK, ""},
+		// The database picker is only served when switching is enabled
+		{"GET", "/api/databases", "", http.StatusNotFound, codeNotFound},
+		{"DELETE", "/api/documents/doc-1", "", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			rec := serve(h, tt.method, tt.target, tt.body, nil)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if rec.Header().Get(requestIDHeader) == "" {
+				t.Error("no request ID header")
+			}
+			if tt.code != "" {
+				if got := decodeError(t, rec).Code; got != tt.code {
+					t.Errorf("code = %q, want %q", got, tt.code)
+				}
+			}
+		})
+	}
+}
+
+// TestAppKeepsClassicDashboard checks that a built app takes over the
+// dashboard's paths but leaves the inline dashboard at classicPath.
+func TestAppKeepsClassicDashboard(t *testing.T) {
+	ws, _ := newTestWebServer(t, WebServerOptions{})
+	ws.app = fstest.MapFS{
+		"index.html":    {Data: []byte("<html><head></head><body>app</body></html>")},
+		"assets/app.js": {Data: []byte("console.log('app')")},
+	}
+	h := ws.Handler()
+
+	for _, target := range []string{"/", "/documents"} {
+		rec := serve(h, "GET", target, "", nil)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "app") {
+			t.Errorf("GET %s: status = %d, want the app: %s", target, rec.Code, rec.Body)
+		}
+	}
+	rec := serve(h, "GET", classicPath, "", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Memory Server Dashboard") {
+		t.Errorf("GET %s: status = %d, want the inline dashboard", classicPath, rec.Code)
+	}
+}
+
+// TestUntaggedDocuments checks that documents without tags have an empty
+// tag list rather than null, which clients would have to guard against.
+func TestUntaggedDocuments(t *testing.T) {
+	ws, store := newTestWebServer(t, WebServerOptions{})
+	if err := store.AddDocument(Document{ID: "untagged", Content: "a memory without tags", CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	h := ws.Handler()
+
+	for _, target := range []string{"/api/documents", "/api/documents/untagged", "/api/search?q=memory"} {
+		rec := serve(h, "GET", target, "", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: status = %d", target, rec.Code)
+		}
+		if body := rec.Body.String(); !strings.Contains(body, `"tags":[]`) {
+			t.Errorf("GET %s: body has no empty tag list: %s", target, body)
+		}
+	}
+}
+
+func TestHandlerKeepsClientRequestID(t *testing.T) {
+	ws, _ := newTestWebServer(t, WebServerOptions{})
+	rec := serve(ws.Handler(), "GET", "/api/stats", "", http.Header{requestIDHeader: {"trace-42"}})
+	if got := rec.Header().Get(requestIDHeader); got != "trace-42" {
+		t.Errorf("request ID = %q, want trace-42", got)
+	}
+}
+
+func TestHandlerWithoutDatabase(t *testing.T) {
+	dir := t.TempDir()
+	ws := NewWebServer(nil, NewUsageStats(), &WebServerOptions{
+		DatabaseDir:         dir,
+		RecentDatabasesPath: filepath.Join(dir, "recent.json"),
+	})
+	h := ws.Handler()
+
+	rec := serve(h, "GET", "/api/stats", "", nil)
+	if rec.Code != http.StatusServiceUnavailable || decodeError(t, rec).Code != codeNoDatabase {
+		t.Fatalf("status = %d, want 503 no_database: %s", rec.Code, rec.Body)
+	}
+	if rec := serve(h, "POST", "/api/databases", `{"path":"first"}`, nil); rec.Code != http.StatusCreated {
+		t.Fatalf("create database: status = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := serve(h, "GET", "/api/stats", "", nil); rec.Code != http.StatusOK {
+		t.Fatalf("stats after opening a database: status = %d: %s", rec.Code, rec.Body)
+	}
+}
+
+// TestSwitchDatabaseWaitsForRequests checks that the store the picker
+// switches away from is only closed once the requests using it are done.
+func TestSwitchDatabaseWaitsForRequests(t *testing.T) {
+	dir := t.TempDir()
+	ws := NewWebServer(nil, NewUsageStats(), &WebServerOptions{
+		DatabaseDir:         dir,
+		RecentDatabasesPath: filepath.Join(dir, "recent.json"),
+	})
+	if _, err := ws.OpenDatabase("first", true); err != nil {
+		t.Fatal(err)
+	}
+
+	started, release := make(chan struct{}), make(chan struct{})
+	done := make(chan int)
+	h := ws.withStore(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		if err := storeOf(r).AddDocument(Document{ID: "late", Content: "written after the switch", CreatedAt: time.Now()}); err != nil {
+			t.Error(err)
+		}
+	})
+	go func() {
+		rec := serve(h, "GET", "/", "", nil)
+		done <- rec.Code
+	}()
+	<-started
+
+	if _, err := ws.OpenDatabase("second", true); err != nil {
+		t.Fatal(err)
+	}
+	closed := make(chan struct{})
+	go func() {
+		ws.closing.Wait()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("previous store closed with a request in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	<-done
+	select {
+	case <-closed:
+	case <-time.After(shutdownTimeout):
+		t.Fatal("previous store not closed after the request finished")
+	}
+}
+
+func TestDatabasePathsStayInDirectory(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "databases")
+	outside := filepath.Join(root, "outside")
+	for _, d := range []string{dir, outside} {
+		if err := os.Mkdir(d, 0o700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	ws := NewWebServer(nil, NewUsageStats(), &WebServerOptions{
+		DatabaseDir:         dir,
+		RecentDatabasesPath: filepath.Join(root, "recent.json"),
+	})
+	ws.app = nil
+	h := ws.Handler()
+
+	for _, path := range []string{outside, "../outside", "a/../../outside", ".", "link", "link/new"} {
+		body, _ := json.Marshal(DatabaseRequest{Path: path})
+		for _, req := range []struct{ method, target string }{{"POST", "/api/databases"}, {"PUT", "/api/databases/current"}} {
+			rec := serve(h, req.method, req.target, string(body), nil)
+			if rec.Code != http.StatusUnprocessableEntity {
+				t.Errorf("%s %s %q: status = %d, want 422", req.method, req.target, path, rec.Code)
+			}
+		}
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Errorf("%d entries were created outside the database directory", len(entries))
+	}
+
+	if rec := serve(h, "POST", "/api/databases", `{"path":"`+filepath.Join(dir, "inside")+`"}`, nil); rec.Code != http.StatusCreated {
+		t.Errorf("absolute path inside the directory: status = %d, want 201: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestJSONBodiesRequireContentType(t *testing.T) {
+	ws, _ := newTestWebServer(t, WebServerOptions{})
+	h := ws.Handler()
+
+	// What a cross-site <form enctype="text/plain"> sends
+	for _, contentType := range []string{"", "text/plain", "application/x-www-form-urlencoded"} {
+		req := httptest.NewRequest("POST", "/api/documents", strings.NewReader(`{"content":"forged"}`))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnsupportedMediaType || decodeError(t, rec).Code != codeUnsupportedMedia {
+			t.Errorf("Content-Type %q: status = %d, want 415 %s", contentType, rec.Code, codeUnsupportedMedia)
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/api/documents", strings.NewReader(`{"content":"kept"}`))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Errorf("application/json with charset: status = %d, want 201: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestCrossSiteRequests(t *testing.T) {
+	ws, _ := newTestWebServer(t, WebServerOptions{})
+	srv := httptest.NewServer(ws.Handler())
+	defer srv.Close()
+
+	tests := []struct {
+		name, method, origin, host string
+		status                     int
+	}{
+		{"write from another site", "POST", "https://evil.example", "", http.StatusForbidden},
+		{"write from an opaque origin", "POST", "null", "", http.StatusForbidden},
+		{"write from the dashboard", "POST", srv.URL, "", http.StatusCreated},
+		{"write from a local dev server", "POST", "http://localhost:5173", "", http.StatusCreated},
+		{"write without origin", "POST", "", "", http.StatusCreated},
+		{"read from another site", "GET", "https://evil.example", "", http.StatusOK},
+		{"DNS rebinding", "GET", "", "evil.example:8080", http.StatusForbidden},
+		{"localhost", "GET", "", "localhost:8080", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader
+			if tt.method == "POST" {
+				body = strings.NewReader(`{"content":"cross-site test"}`)
+			}
+			req, err := http.NewRequest(tt.method, srv.URL+"/api/documents", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.host != "" {
+				req.Host = tt.host
+			}
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+func TestWebCommandRequiresAuthOffLoopback(t *testing.T) {
+	err := WebCommand(context.Background(), []string{"-db-dir", t.TempDir(), "-web-host", "0.0.0.0"})
+	if err == nil || !strings.Contains(err.Error(), "-auth") {
+		t.Errorf("err = %v, want a refusal without -auth", err)
+	}
+}
+
+func TestMCPHandlerRefusesCrossSiteRequests(t *testing.T) {
+	store, err := NewMemoryStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(NewMCPServer(store, NewUsageStats(), nil).HTTPHandler())
+	defer srv.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	req.Header.Set("Origin", "https://evil.example")
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", resp.StatusCode)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	tokens, err := LoadTokenStore(filepath.Join(t.TempDir(), TokensFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, info, err := tokens.CreateToken("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws, _ := newTestWebServer(t, WebServerOptions{Tokens: tokens})
+	h := ws.Handler()
+	bearer := func(token string) http.Header {
+		return http.Header{"Authorization": {"Bearer " + token}}
+	}
+
+	t.Run("API without token", func(t *testing.T) {
+		rec := serve(h, "GET", "/api/stats", "", nil)
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("status = %d, want 401", rec.Code)
+		}
+		if rec.Header().Get("WWW-Authenticate") == "" {
+			t.Error("no WWW-Authenticate header")
+		}
+		if got := decodeError(t, rec).Code; got != codeUnauthorized {
+			t.Errorf("code = %q, want %q", got, codeUnauthorized)
+		}
+	})
+	t.Run("API with invalid token", func(t *testing.T) {
+		if rec := serve(h, "GET", "/api/stats", "", bearer("mcm_wrong")); rec.Code != http.StatusUnauthorized {
+			t.Errorf("status = %d, want 401", rec.Code)
+		}
+	})
+	t.Run("API with another scheme", func(t *testing.T) {
+		header := http.Header{"Authorization": {"Basic " + token}}
+		if rec := serve(h, "GET", "/api/stats", "", header); rec.Code != http.StatusUnauthorized {
+			t.Errorf("status = %d, want 401", rec.Code)
+		}
+	})
+	t.Run("API with token", func(t *testing.T) {
+		if rec := serve(h, "GET", "/api/stats", "", bearer(token)); rec.Code != http.StatusOK {
+			t.Errorf("status = %d, want 200: %s", rec.Code, rec.Body)
+		}
+	})
+	t.Run("metrics without token", func(t *testing.T) {
+		if rec := serve(h, "GET", "/metrics", "", nil); rec.Code != http.StatusUnauthorized {
+			t.Errorf("status = %d, want 401", rec.Code)
+		}
+	})
+	t.Run("pages redirect to login", func(t *testing.T) {
+		for _, path := range []string{"/", "/documents", explorerPath} {
+			rec := serve(h, "GET", path, "", nil)
+			if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/login" {
+				t.Errorf("%s: status = %d, location = %q, want redirect to /login", path, rec.Code, rec.Header().Get("Location"))
+			}
+		}
+	})
+	t.Run("failed login", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/login", strings.NewReader("token=mcm_wrong"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("status = %d, want 401", rec.Code)
+		}
+		if len(rec.Result().Cookies()) != 0 {
+			t.Error("failed login set a cookie")
+		}
+	})
+
+	// Log in, use the session, then log out
+	req := httptest.NewRequest("POST", "/login", strings.NewReader("token="+token))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("login: status = %d, want 303", rec.Code)
+	}
+	var cookie *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == sessionCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil || !cookie.HttpOnly || cookie.SameSite != http.SameSiteStrictMode {
+		t.Fatalf("login: session cookie = %+v, want an HttpOnly, SameSite=Strict cookie", cookie)
+	}
+	withCookie := http.Header{"Cookie": {cookie.String()}}
+	if rec := serve(h, "GET", "/api/stats", "", withCookie); rec.Code != http.StatusOK {
+		t.Fatalf("session: status = %d, want 200", rec.Code)
+	}
+	if rec := serve(h, "POST", "/logout", "", withCookie); rec.Code != http.StatusSeeOther {
+		t.Fatalf("logout: status = %d, want 303", rec.Code)
+	}
+	if rec := serve(h, "GET", "/api/stats", "", withCookie); rec.Code != http.StatusUnauthorized {
+		t.Errorf("after logout: status = %d, want 401", rec.Code)
+	}
+
+	t.Run("revoked token", func(t *testing.T) {
+		if err := tokens.RevokeToken(info.ID); err != nil {
+			t.Fatal(err)
+		}
+		if rec := serve(h, "GET", "/api/stats", "", bearer(token)); rec.Code != http.StatusUnauthorized {
+			t.Errorf("status = %d, want 401", rec.Code)
+		}
+	})
+}
+
+func TestTokenRevokedByAnotherProcess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), TokensFileName)
+	server, err := LoadTokenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, info, err := server.CreateToken("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sid, ok := server.startSession(token)
+	if !ok {
+		t.Fatal("could not start session")
+	}
+
+	// Make sure the file's modification time changes
+	time.Sleep(10 * time.Millisecond)
+	var out strings.Builder
+	if err := TokensCommand([]string{"-db-path", filepath.Dir(path), "revoke", info.ID}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := server.Verify(token); ok {
+		t.Error("token still valid after it was revoked by the tokens command")
+	}
+	if server.validSession(sid) {
+		t.Error("session still valid after its token was revoked")
+	}
+}
+
+func TestRunShutsDownGracefully(t *testing.T) {
+	ws, store := newTestWebServer(t, WebServerOptions{})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- ws.Run(ctx, l.Addr().(*net.TCPAddr).Port) }()
+
+	var conn net.Conn
+	waitFor(t, func() bool {
+		conn, err = net.Dial("tcp", addr)
+		return err == nil
+	})
+	defer conn.Close()
+
+	// Start a request and wait until its handler reads the body, which it
+	// announces with 100 Continue; the request is then in flight when the
+	// server is asked to stop and must be completed rather than cut off.
+	body := `{"content":"written during shutdown"}`
+	fmt.Fprintf(conn, "POST /api/documents HTTP/1.1\r\nHost: %s\r\nContent-Type: application/json\r\nContent-Length: %d\r\nExpect: 100-continue\r\n\r\n", addr, len(body))
+	r := bufio.NewReader(conn)
+	if line, err := r.ReadString('\n'); err != nil || !strings.Contains(line, "100 Continue") {
+		t.Fatalf("expected 100 Continue, got %q (%v)", line, err)
+	}
+	if _, err := r.ReadString('\n'); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	waitFor(t, func() bool {
+		c, err := net.Dial("tcp", addr)
+		if err == nil {
+			c.Close()
+		}
+		return err != nil
+	})
+	select {
+	case err := <-done:
+		t.Fatalf("Run returned with a request in flight: %v", err)
+	default:
+	}
+
+	io.WriteString(conn, body)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatalf("in-flight request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("in-flight request: status = %d, want 201", resp.StatusCode)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run returned %v", err)
+		}
+	case <-time.After(shutdownTimeout):
+		t.Fatal("Run did not return after shutdown")
+	}
+	docs, err := store.ListDocuments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 1 {
+		t.Errorf("store has %d documents after shutdown, want 1", len(docs))
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds.
+// TestRunHTTPEndsEventStreams checks that an MCP client listening for server
+// messages does not hold up shutdown until it times out.
+func TestRunHTTPEndsEventStreams(t *testing.T) {
+	_, store := newTestWebServer(t, WebServerOptions{})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- NewMCPServer(store, NewUsageStats(), nil).RunHTTP(ctx, addr) }()
+
+	request := func(method, body, session string) *http.Response {
+		req, _ := http.NewRequest(method, "http://"+addr, strings.NewReader(body))
+		req.Header.Set("Accept", "application/json, text/event-stream")
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if session != "" {
+			req.Header.Set("Mcp-Session-Id", session)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	waitFor(t, func() bool {
+		c, err := net.Dial("tcp", addr)
+		if err == nil {
+			c.Close()
+		}
+		return err == nil
+	})
+	resp := request("POST", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`, "")
+	resp.Body.Close()
+	session := resp.Header.Get("Mcp-Session-Id")
+	request("POST", `{"jsonrpc":"2.0","method":"notifications/initialized"}`, session).Body.Close()
+	stream := request("GET", "", session)
+	defer stream.Body.Close()
+	if stream.StatusCode != http.StatusOK {
+		t.Fatalf("GET: status = %d, want 200", stream.StatusCode)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("RunHTTP returned %v", err)
+		}
+	case <-time.After(shutdownTimeout / 2):
+		t.Fatal("RunHTTP waited for the event stream")
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestExportImportRoundTrip exports more than one page of documents and
+// imports them into a second store.
+func TestExportImportRoundTrip(t *testing.T) {
+	ws, store := newTestWebServer(t, WebServerOptions{})
+	total := exportPageSize + 5
+	created := time.Now().Add(-time.Hour)
+	for i := range total {
+		doc := Document{ID: fmt.Sprintf("doc-%03d", i), Content: fmt.Sprintf("memory number %d", i), CreatedAt: created.Add(time.Duration(i) * time.Second)}
+		if err := store.AddDocument(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := serve(ws.Handler(), http.MethodGet, "/api/export?format=jsonl", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export status = %d, want 200", rec.Code)
+	}
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if len(lines) != total {
+		t.Fatalf("export has %d lines, want %d", len(lines), total)
+	}
+	var first Document
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil || first.ID != "doc-000" {
+		t.Errorf("first exported document = %q (%v), want doc-000", first.ID, err)
+	}
+
+	target, _ := newTestWebServer(t, WebServerOptions{})
+	rec = serve(target.Handler(), http.MethodPost, "/api/import?format=jsonl", rec.Body.String(), nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("import status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var report ImportReport
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Imported != total || len(report.Errors) != 0 {
+		t.Errorf("import report = %+v, want %d imported without errors", report, total)
+	}
+}
+
+// TestImportProvenance checks that the REST import, like POST
+// /api/documents, only keeps the source fields of the given provenance.
+func TestImportProvenance(t *testing.T) {
+	ws, store := newTestWebServer(t, WebServerOptions{})
+	body := `{"id":"imported","content":"a memory","provenance":{"client":"claude-code","client_version":"1.0","session_id":"abc","source_repo":"repo"}}`
+	rec := serve(ws.Handler(), http.MethodPost, "/api/import?format=jsonl", body, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("import status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	doc, err := store.GetDocument("imported")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Provenance{Client: WebClient, SourceRepo: "repo"}
+	if doc.Provenance != want {
+		t.Errorf("provenance = %+v, want %+v", doc.Provenance, want)
+	}
+}
+
+func TestImportTooLarge(t *testing.T) {
+	ws, _ := newTestWebServer(t, WebServerOptions{})
+	// Blank lines, so that only the size of the body is at fault
+	body := io.LimitReader(blankLines{}, maxImportSize+1)
+	req := httptest.NewRequest(http.MethodPost, "/api/import?format=jsonl", body)
+	rec := httptest.NewRecorder()
+	ws.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want 413", rec.Code)
+	}
+	if apiErr := decodeError(t, rec); apiErr.Code != codeTooLarge {
+		t.Errorf("code = %q, want %q", apiErr.Code, codeTooLarge)
+	}
+}
+
+// blankLines reads as an endless run of 1 KiB lines of spaces.
+type blankLines struct{}
+
+func (blankLines) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = ' '
+		if i%1024 == 1023 {
+			p[i] = '\n'
+		}
+	}
+	return len(p), nil
+}
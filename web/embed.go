@@ -0,0 +1,35 @@
+// Package web embeds the dashboard, a React single-page app built from this
+// directory with "npm run build" (or "make web"). Until it has been built,
+// dist only holds a placeholder and the web server falls back to its inline
+// dashboard.
+package web
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed all:dist
+var dist embed.FS
+
+//go:embed src/lib/markdown.js
+var markdown []byte
+
+// Dist returns the built app, with index.html at its root, or nil if the app
+// has not been built.
+func Dist() fs.FS {
+	app, err := fs.Sub(dist, "dist")
+	if err != nil {
+		return nil
+	}
+	if _, err := fs.Stat(app, "index.html"); err != nil {
+		return nil
+	}
+	return app
+}
+
+// Markdown returns the markdown renderer of the app, an ES module that the
+// inline dashboard imports as well.
+func Markdown() []byte {
+	return markdown
+}
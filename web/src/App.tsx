@@ -0,0 +1,19 @@
+import { Navigate, Route, Routes } from "react-router"
+
+import { Layout } from "@/components/layout"
+import { DashboardPage } from "@/pages/dashboard"
+import { DocumentsPage } from "@/pages/documents"
+
+// The server answers every unknown non-API path with index.html, so these
+// routes also work when opened directly or reloaded.
+export default function App() {
+  return (
+    <Routes>
+      <Route element={<Layout />}>
+        <Route index element={<DashboardPage />} />
+        <Route path="documents" element={<DocumentsPage />} />
+        <Route path="*" element={<Navigate to="/" replace />} />
+      </Route>
+    </Routes>
+  )
+}
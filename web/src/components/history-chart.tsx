@@ -0,0 +1,49 @@
+import type { Stats } from "@/lib/api"
+
+const height = 180
+const bottom = 20
+const slot = 24
+
+// HistoryChart draws the operations per day as a bar chart, like the inline
+// dashboard: all operations, or only op. Every seventh day is labelled.
+export function HistoryChart({ history, op }: { history: Stats["history"]; op: string }) {
+  const values = history.map((day) =>
+    op ? (day.counts[op] ?? 0) : Object.values(day.counts).reduce((sum, n) => sum + n, 0),
+  )
+  const max = Math.max(1, ...values)
+  const width = slot * Math.max(1, history.length)
+
+  return (
+    <svg
+      viewBox={`0 0 ${width} ${height}`}
+      className="max-h-60 w-full"
+      role="img"
+      aria-label="Operations per day"
+    >
+      {history.map((day, i) => {
+        const barHeight = ((height - bottom - 15) * values[i]) / max
+        return (
+          <g key={day.date}>
+            <rect
+              className="fill-primary"
+              x={i * slot + 2}
+              y={height - bottom - barHeight}
+              width={slot - 4}
+              height={barHeight}
+            >
+              <title>{`${day.date}: ${values[i]}`}</title>
+            </rect>
+            {(i % 7 === history.length % 7 || i === history.length - 1) && (
+              <text className="fill-muted-foreground text-[10px]" x={i * slot + slot / 2} y={height - 5} textAnchor="middle">
+                {day.date.slice(5)}
+              </text>
+            )}
+          </g>
+        )
+      })}
+      <text className="fill-muted-foreground text-[10px]" x={2} y={10}>
+        max {max}
+      </text>
+    </svg>
+  )
+}
@@ -0,0 +1,86 @@
+import { AppWindow, Database, FileText, LayoutDashboard, LogOut, SquareTerminal } from "lucide-react"
+import { NavLink, Outlet } from "react-router"
+
+import { Button } from "@/components/ui/button"
+import { serverConfig } from "@/lib/api"
+import { cn } from "@/lib/utils"
+
+const navigation = [
+  { to: "/", label: "Dashboard", icon: LayoutDashboard, end: true },
+  { to: "/documents", label: "Documents", icon: FileText, end: false },
+]
+
+// Layout is the shell of every page: a sidebar with the navigation and links
+// to the pages served by the Go server itself, and the routed page.
+export function Layout() {
+  const config = serverConfig()
+
+  return (
+    <div className="flex min-h-svh">
+      <aside className="bg-sidebar text-sidebar-foreground border-sidebar-border sticky top-0 flex h-svh w-60 shrink-0 flex-col border-r">
+        <div className="px-4 py-5">
+          <div className="text-lg font-semibold">Memory Server</div>
+          <div className="text-muted-foreground text-xs">Local Memory Layer for Developers</div>
+        </div>
+        <nav className="flex flex-col gap-1 px-2">
+          {navigation.map(({ to, label, icon: Icon, end }) => (
+            <NavLink
+              key={to}
+              to={to}
+              end={end}
+              className={({ isActive }) =>
+                cn(
+                  "hover:bg-sidebar-accent hover:text-sidebar-accent-foreground flex items-center gap-2 rounded-md px-3 py-2 text-sm",
+                  isActive && "bg-sidebar-accent text-sidebar-accent-foreground font-medium",
+                )
+              }
+            >
+              <Icon className="size-4" />
+              {label}
+            </NavLink>
+          ))}
+          <a
+            href="/api/explorer"
+            className="hover:bg-sidebar-accent flex items-center gap-2 rounded-md px-3 py-2 text-sm"
+          >
+            <SquareTerminal className="size-4" />
+            API explorer
+          </a>
+          <a
+            href="/classic"
+            className="hover:bg-sidebar-accent flex items-center gap-2 rounded-md px-3 py-2 text-sm"
+          >
+            <AppWindow className="size-4" />
+            Classic dashboard
+          </a>
+        </nav>
+        <div className="mt-auto flex flex-col gap-2 p-4 text-xs">
+          {config.switch_databases && (
+            <>
+              <div className="text-muted-foreground truncate font-mono" title={config.database}>
+                {config.database}
+              </div>
+              <Button variant="outline" size="sm" asChild>
+                <a href="/databases">
+                  <Database />
+                  Switch database
+                </a>
+              </Button>
+            </>
+          )}
+          {config.auth && (
+            <form method="post" action="/logout">
+              <Button variant="ghost" size="sm" type="submit" className="w-full justify-start">
+                <LogOut />
+                Log out
+              </Button>
+            </form>
+          )}
+        </div>
+      </aside>
+      <main className="min-w-0 flex-1 p-6">
+        <Outlet />
+      </main>
+    </div>
+  )
+}
@@ -0,0 +1,15 @@
+import { useMemo } from "react"
+
+import { renderMarkdown } from "@/lib/markdown"
+import { cn } from "@/lib/utils"
+
+// Markdown shows memory content as markdown, or as plain text when render is
+// off. renderMarkdown escapes all text, which is what makes setting its
+// output as HTML safe.
+export function Markdown({ content, render, className }: { content: string; render: boolean; className?: string }) {
+  const html = useMemo(() => (render ? renderMarkdown(content) : ""), [content, render])
+  if (!render) {
+    return <div className={cn("break-words whitespace-pre-wrap", className)}>{content}</div>
+  }
+  return <div className={cn("markdown", className)} dangerouslySetInnerHTML={{ __html: html }} />
+}
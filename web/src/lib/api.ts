@@ -0,0 +1,150 @@
+// Client for the REST API served by the Go WebServer. The types mirror the Go
+// request and response types; see /api/openapi.json for the full schemas.
+
+export interface Provenance {
+  client?: string
+  client_version?: string
+  session_id?: string
+  source_file?: string
+  source_repo?: string
+  source_commit?: string
+}
+
+export interface Document {
+  id: string
+  content: string
+  tags: string[]
+  properties: Record<string, string> | null
+  favorite: boolean
+  created_at: string
+  provenance: Provenance
+  // score is only set on search results.
+  score?: number
+}
+
+export type DocumentInput = Pick<Document, "content" | "tags" | "favorite" | "properties">
+
+export interface LatencySummary {
+  count: number
+  mean_ms: number
+  p50_ms: number
+  p95_ms: number
+  p99_ms: number
+}
+
+export interface ImportReport {
+  imported: number
+  replaced: number
+  errors?: { row: number; id?: string; code: string; message: string }[]
+}
+
+export type ExportFormat = "json" | "jsonl" | "csv"
+
+export interface Stats {
+  total_documents: number
+  usage: Record<string, Record<string, number>>
+  lifetime_usage: Record<string, Record<string, number>>
+  started_at: string
+  history: { date: string; counts: Record<string, number> }[]
+  latency: Record<string, LatencySummary>
+}
+
+// APIError is the body of every error response.
+export class APIError extends Error {
+  constructor(
+    readonly status: number,
+    readonly code: string,
+    message: string,
+    readonly requestId?: string,
+  ) {
+    super(message)
+  }
+}
+
+async function request<T>(method: string, url: string, body?: unknown): Promise<T> {
+  return send<T>(url, {
+    method,
+    headers: body === undefined ? undefined : { "Content-Type": "application/json" },
+    body: body === undefined ? undefined : JSON.stringify(body),
+  })
+}
+
+async function send<T>(url: string, init: RequestInit): Promise<T> {
+  const response = await fetch(url, init)
+  if (response.status === 401) {
+    window.location.href = "/login"
+  }
+  if (response.status === 503) {
+    // No database is open yet; the server hosts the picker.
+    window.location.href = "/databases"
+  }
+  if (!response.ok) {
+    const error = await response.json().catch(() => ({}))
+    throw new APIError(
+      response.status,
+      error.code ?? "unknown",
+      error.message ?? response.statusText,
+      error.request_id,
+    )
+  }
+  return response.json() as Promise<T>
+}
+
+const documentURL = (id: string) => "/api/documents/" + encodeURIComponent(id)
+
+export const api = {
+  stats: () => request<Stats>("GET", "/api/stats"),
+  documents: () => request<Document[]>("GET", "/api/documents"),
+  createDocument: (doc: DocumentInput) => request<{ id: string }>("POST", "/api/documents", doc),
+  updateDocument: (id: string, doc: DocumentInput) => request<{ id: string }>("PUT", documentURL(id), doc),
+  deleteDocument: (id: string) => request<{ id: string }>("DELETE", documentURL(id)),
+  setFavorite: (id: string, favorite: boolean) =>
+    request<{ id: string; favorite: boolean }>("PUT", documentURL(id) + "/favorite", { favorite }),
+  search: (query: string) => request<Document[]>("GET", "/api/search?q=" + encodeURIComponent(query)),
+  // importDocuments sends a file in one of the export formats, which the
+  // server tells apart by the format parameter.
+  importDocuments: (file: File, format: ExportFormat) =>
+    send<ImportReport>("/api/import?format=" + format, { method: "POST", body: file }),
+}
+
+export const exportURL = (format: ExportFormat) => "/api/export?format=" + format
+
+// importFormat returns the format of a file to import, judged by its name.
+export function importFormat(name: string): ExportFormat | null {
+  const extension = name.slice(name.lastIndexOf(".") + 1).toLowerCase()
+  switch (extension) {
+    case "json":
+      return "json"
+    case "jsonl":
+    case "ndjson":
+      return "jsonl"
+    case "csv":
+      return "csv"
+    default:
+      return null
+  }
+}
+
+// ServerConfig is injected by the server into index.html as a meta tag.
+export interface ServerConfig {
+  auth: boolean
+  switch_databases: boolean
+  database?: string
+}
+
+export function serverConfig(): ServerConfig {
+  const meta = document.querySelector<HTMLMetaElement>('meta[name="memory-server"]')
+  try {
+    return { auth: false, switch_databases: false, ...JSON.parse(meta?.content ?? "{}") }
+  } catch {
+    return { auth: false, switch_databases: false }
+  }
+}
+
+// parseTags splits a comma-separated tag list as the server expects it.
+export function parseTags(value: string): string[] {
+  return value
+    .split(",")
+    .map((tag) => tag.trim())
+    .filter((tag) => tag !== "")
+}
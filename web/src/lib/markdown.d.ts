@@ -0,0 +1,5 @@
+// Types of markdown.js, which stays JavaScript so that the inline dashboard
+// can load it unchanged.
+
+// renderMarkdown returns content as HTML in which all text is escaped.
+export function renderMarkdown(text: string): string
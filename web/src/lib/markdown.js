@@ -0,0 +1,143 @@
+// Markdown rendering of memory content, shared by the app and the inline
+// dashboard: the Go server embeds this file and serves it to the inline
+// dashboard as is, which is why it is plain JavaScript (markdown.d.ts
+// declares its types). Memory content is untrusted (agents store snippets
+// from web pages): all text is escaped before any markup is added, so the
+// result is safe to set as innerHTML.
+
+const htmlEscapes = { "&": "&amp;", "<": "&lt;", ">": "&gt;", '"': "&quot;", "'": "&#39;" }
+
+function escapeHTML(text) {
+  return text.replace(/[&<>"']/g, (c) => htmlEscapes[c])
+}
+
+// renderMarkdown supports the subset agents commonly write: fenced code
+// blocks, headings, lists, links, inline code and emphasis.
+export function renderMarkdown(text) {
+  const lines = text.replace(/\r\n?/g, "\n").split("\n")
+  const out = []
+  let paragraph = []
+  let list = null
+
+  const flushParagraph = () => {
+    if (paragraph.length) {
+      out.push("<p>" + paragraph.map(renderInline).join("<br>") + "</p>")
+      paragraph = []
+    }
+  }
+  const flushList = () => {
+    if (list) {
+      const items = list.items.map((item) => "<li>" + renderInline(item) + "</li>").join("")
+      out.push("<" + list.tag + ">" + items + "</" + list.tag + ">")
+      list = null
+    }
+  }
+
+  for (let i = 0; i < lines.length; i++) {
+    const line = lines[i]
+    const fence = line.match(/^\s*```\s*([\w+#-]*)\s*$/)
+    if (fence) {
+      flushParagraph()
+      flushList()
+      const code = []
+      for (i++; i < lines.length && !/^\s*```\s*$/.test(lines[i]); i++) {
+        code.push(lines[i])
+      }
+      out.push("<pre><code>" + highlightCode(code.join("\n"), fence[1]) + "</code></pre>")
+      continue
+    }
+
+    const heading = line.match(/^(#{1,6})\s+(.*)$/)
+    if (heading) {
+      flushParagraph()
+      flushList()
+      const level = heading[1].length
+      out.push("<h" + level + ">" + renderInline(heading[2]) + "</h" + level + ">")
+      continue
+    }
+
+    const item = line.match(/^\s*([-*+]|\d+\.)\s+(.*)$/)
+    if (item) {
+      flushParagraph()
+      const tag = /\d/.test(item[1]) ? "ol" : "ul"
+      if (list && list.tag !== tag) {
+        flushList()
+      }
+      list ??= { tag, items: [] }
+      list.items.push(item[2])
+      continue
+    }
+
+    if (!line.trim()) {
+      flushParagraph()
+      flushList()
+      continue
+    }
+    flushList()
+    paragraph.push(line)
+  }
+  flushParagraph()
+  flushList()
+  return out.join("")
+}
+
+function renderInline(text) {
+  return text
+    .split(/(`[^`]*`)/)
+    .map((part, i) => {
+      if (i % 2 === 1) {
+        return "<code>" + escapeHTML(part.slice(1, -1)) + "</code>"
+      }
+      return escapeHTML(part)
+        .replace(/\[([^\]]+)\]\(([^)\s]+)\)/g, (match, label, url) =>
+          /^(https?:|mailto:)/i.test(url)
+            ? '<a href="' + url + '" target="_blank" rel="noopener noreferrer">' + label + "</a>"
+            : match,
+        )
+        .replace(/\*\*([^*]+)\*\*/g, "<strong>$1</strong>")
+        .replace(/(^|[^*\w])\*([^*]+)\*(?![*\w])/g, "$1<em>$2</em>")
+        .replace(/(^|\W)_([^_]+)_(?!\w)/g, "$1<em>$2</em>")
+    })
+    .join("")
+}
+
+const codeKeywords = new Set(
+  (
+    "break case catch class const continue def default defer do elif else enum export " +
+    "extends false fn for from func function go if impl import in interface let match mut nil None null package " +
+    "pub raise return select self static struct switch this throw true True False try type undefined var while with yield"
+  ).split(" "),
+)
+
+// highlightCode tokenizes code before escaping it, so that the markup only
+// ever wraps escaped text. It is deliberately language agnostic; lang only
+// decides whether '#' starts a comment.
+function highlightCode(code, lang) {
+  const hashComments = /^(sh|bash|zsh|shell|py|python|rb|ruby|yaml|yml|toml|dockerfile|make|makefile)$/i.test(lang)
+  const comment = hashComments ? "#[^\\n]*" : "//[^\\n]*|/\\*[\\s\\S]*?\\*/"
+  const token = new RegExp(
+    "(" +
+      comment +
+      ")|(\"(?:[^\"\\\\\\n]|\\\\.)*\"|'(?:[^'\\\\\\n]|\\\\.)*'|`[^`]*`)|(\\b\\d[\\w.]*)|([A-Za-z_]\\w*)",
+    "g",
+  )
+  let html = ""
+  let last = 0
+  for (const m of code.matchAll(token)) {
+    html += escapeHTML(code.slice(last, m.index))
+    const text = escapeHTML(m[0])
+    if (m[1]) {
+      html += '<span class="tok-comment">' + text + "</span>"
+    } else if (m[2]) {
+      html += '<span class="tok-string">' + text + "</span>"
+    } else if (m[3]) {
+      html += '<span class="tok-number">' + text + "</span>"
+    } else if (codeKeywords.has(m[4])) {
+      html += '<span class="tok-keyword">' + text + "</span>"
+    } else {
+      html += text
+    }
+    last = m.index + m[0].length
+  }
+  return html + escapeHTML(code.slice(last))
+}
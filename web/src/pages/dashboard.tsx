@@ -0,0 +1,182 @@
+import { useEffect, useState } from "react"
+
+import { HistoryChart } from "@/components/history-chart"
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from "@/components/ui/card"
+import { Table, TableBody, TableCell, TableHead, TableHeader, TableRow } from "@/components/ui/table"
+import { api, type LatencySummary, type Stats } from "@/lib/api"
+
+// The tool counts shown as cards, by operation name in the stats.
+const tools = [
+  { op: "add_document", label: "Add document" },
+  { op: "get_document", label: "Get document" },
+  { op: "get_all_documents", label: "Get all documents" },
+  { op: "update_document", label: "Update document" },
+  { op: "delete_document", label: "Delete document" },
+  { op: "search", label: "Search" },
+]
+
+// The operations the history chart can be narrowed to.
+const historyOperations = [
+  { op: "", label: "All operations" },
+  { op: "add_document", label: "Add" },
+  { op: "search", label: "Search" },
+  { op: "get_context", label: "Get context" },
+  { op: "update_document", label: "Update" },
+  { op: "delete_document", label: "Delete" },
+]
+
+const refreshInterval = 10_000
+
+function milliseconds(value: number): string {
+  return value.toFixed(value < 1 ? 3 : 1) + " ms"
+}
+
+// The columns of the latency table, after the phase.
+const latencyColumns: { label: string; value: (s: LatencySummary) => string }[] = [
+  { label: "Count", value: (s) => String(s.count) },
+  { label: "Mean", value: (s) => milliseconds(s.mean_ms) },
+  { label: "p50", value: (s) => milliseconds(s.p50_ms) },
+  { label: "p95", value: (s) => milliseconds(s.p95_ms) },
+  { label: "p99", value: (s) => milliseconds(s.p99_ms) },
+]
+
+function total(counts: Record<string, number> | undefined): number {
+  return Object.values(counts ?? {}).reduce((sum, n) => sum + n, 0)
+}
+
+export function DashboardPage() {
+  const [stats, setStats] = useState<Stats | null>(null)
+  const [error, setError] = useState("")
+  const [historyOp, setHistoryOp] = useState("")
+
+  useEffect(() => {
+    const load = () =>
+      api
+        .stats()
+        .then((s) => {
+          setStats(s)
+          setError("")
+        })
+        .catch((e: Error) => setError(e.message))
+    load()
+    const timer = setInterval(load, refreshInterval)
+    return () => clearInterval(timer)
+  }, [])
+
+  const operations = stats ? Object.keys(stats.lifetime_usage).sort() : []
+  const phases = stats ? Object.keys(stats.latency ?? {}).sort() : []
+
+  return (
+    <div className="flex flex-col gap-6">
+      <div>
+        <h1 className="text-2xl font-semibold">Dashboard</h1>
+        {stats && (
+          <p className="text-muted-foreground text-sm">
+            Running since {new Date(stats.started_at).toLocaleString()}
+          </p>
+        )}
+      </div>
+      {error && <p className="text-destructive text-sm">{error}</p>}
+
+      <div className="grid grid-cols-[repeat(auto-fit,minmax(180px,1fr))] gap-4">
+        <Card>
+          <CardHeader>
+            <CardDescription>Saved documents</CardDescription>
+            <CardTitle className="text-3xl">{stats?.total_documents ?? "–"}</CardTitle>
+          </CardHeader>
+        </Card>
+        {tools.map(({ op, label }) => (
+          <Card key={op}>
+            <CardHeader>
+              <CardDescription>{label}</CardDescription>
+              <CardTitle className="text-3xl">{stats ? total(stats.usage[op]) : "–"}</CardTitle>
+            </CardHeader>
+            <CardContent className="text-muted-foreground text-xs">
+              {stats ? total(stats.lifetime_usage[op]) : "–"} in total
+            </CardContent>
+          </Card>
+        ))}
+      </div>
+
+      <Card>
+        <CardHeader className="flex flex-row items-center justify-between gap-4">
+          <div className="grid gap-1.5">
+            <CardTitle>Activity</CardTitle>
+            <CardDescription>Operations per day over the last {stats?.history.length ?? 30} days</CardDescription>
+          </div>
+          <select
+            className="border-input bg-background h-9 rounded-md border px-3 text-sm"
+            aria-label="Operation"
+            value={historyOp}
+            onChange={(e) => setHistoryOp(e.target.value)}
+          >
+            {historyOperations.map(({ op, label }) => (
+              <option key={op} value={op}>
+                {label}
+              </option>
+            ))}
+          </select>
+        </CardHeader>
+        <CardContent className="flex flex-col gap-6">
+          <HistoryChart history={stats?.history ?? []} op={historyOp} />
+          {phases.length > 0 && (
+            <Table>
+              <TableHeader>
+                <TableRow>
+                  <TableHead>Latency</TableHead>
+                  {latencyColumns.map(({ label }) => (
+                    <TableHead key={label} className="text-right">
+                      {label}
+                    </TableHead>
+                  ))}
+                </TableRow>
+              </TableHeader>
+              <TableBody>
+                {phases.map((phase) => (
+                  <TableRow key={phase}>
+                    <TableCell className="font-mono">{phase}</TableCell>
+                    {latencyColumns.map(({ label, value }) => (
+                      <TableCell key={label} className="text-right tabular-nums">
+                        {value(stats!.latency[phase])}
+                      </TableCell>
+                    ))}
+                  </TableRow>
+                ))}
+              </TableBody>
+            </Table>
+          )}
+        </CardContent>
+      </Card>
+
+      <Card>
+        <CardHeader>
+          <CardTitle>Usage by channel</CardTitle>
+          <CardDescription>Since startup, with lifetime totals in parentheses</CardDescription>
+        </CardHeader>
+        <CardContent>
+          <Table>
+            <TableHeader>
+              <TableRow>
+                <TableHead>Operation</TableHead>
+                <TableHead className="text-right">MCP</TableHead>
+                <TableHead className="text-right">REST</TableHead>
+              </TableRow>
+            </TableHeader>
+            <TableBody>
+              {operations.map((op) => (
+                <TableRow key={op}>
+                  <TableCell className="font-mono">{op}</TableCell>
+                  {["mcp", "rest"].map((channel) => (
+                    <TableCell key={channel} className="text-right tabular-nums">
+                      {stats!.usage[op]?.[channel] ?? 0} ({stats!.lifetime_usage[op]?.[channel] ?? 0})
+                    </TableCell>
+                  ))}
+                </TableRow>
+              ))}
+            </TableBody>
+          </Table>
+        </CardContent>
+      </Card>
+    </div>
+  )
+}
@@ -0,0 +1,470 @@
+import { useCallback, useEffect, useMemo, useState, type FormEvent, type ReactNode } from "react"
+import { ArrowDown, ArrowUp, ArrowUpDown, Check, Download, Pencil, Plus, Search, Star, Trash2, Upload, X } from "lucide-react"
+
+import { Markdown } from "@/components/markdown"
+import { Badge } from "@/components/ui/badge"
+import { Button } from "@/components/ui/button"
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from "@/components/ui/card"
+import { Input } from "@/components/ui/input"
+import { Table, TableBody, TableCell, TableHead, TableHeader, TableRow } from "@/components/ui/table"
+import { Textarea } from "@/components/ui/textarea"
+import {
+  api,
+  exportURL,
+  importFormat,
+  parseTags,
+  type Document,
+  type ExportFormat,
+  type ImportReport,
+  type Provenance,
+} from "@/lib/api"
+import { cn } from "@/lib/utils"
+
+type SortKey = "favorite" | "content" | "tags" | "created_at"
+type Sort = { key: SortKey; descending: boolean }
+
+const compare: Record<SortKey, (a: Document, b: Document) => number> = {
+  favorite: (a, b) => Number(a.favorite) - Number(b.favorite),
+  content: (a, b) => a.content.localeCompare(b.content),
+  tags: (a, b) => a.tags.join(",").localeCompare(b.tags.join(",")),
+  created_at: (a, b) => a.created_at.localeCompare(b.created_at),
+}
+
+const defaultSort: Sort = { key: "created_at", descending: true }
+
+// renderSetting is shared with the inline dashboard, so the choice carries
+// over between the two.
+const renderSetting = "renderMarkdown"
+
+function matches(doc: Document, filter: string): boolean {
+  const needle = filter.toLowerCase()
+  return doc.content.toLowerCase().includes(needle) || doc.tags.some((tag) => tag.toLowerCase().includes(needle))
+}
+
+// formatProvenance summarizes who created a document and from where.
+function formatProvenance(p: Provenance): string {
+  const parts: string[] = []
+  if (p.client) {
+    parts.push(p.client + (p.client_version ? " " + p.client_version : ""))
+  }
+  if (p.source_repo) {
+    parts.push(p.source_repo + (p.source_commit ? "@" + p.source_commit : ""))
+  } else if (p.source_commit) {
+    parts.push(p.source_commit)
+  }
+  if (p.source_file) {
+    parts.push(p.source_file)
+  }
+  return parts.join(" · ")
+}
+
+export function DocumentsPage() {
+  const [documents, setDocuments] = useState<Document[]>([])
+  const [error, setError] = useState("")
+  const [filter, setFilter] = useState("")
+  // search is the query whose results are shown instead of all documents,
+  // in order of relevance until a column is sorted.
+  const [search, setSearch] = useState("")
+  const [sort, setSort] = useState<Sort | null>(defaultSort)
+  const [editing, setEditing] = useState<string | null>(null)
+  const [render, setRender] = useState(() => localStorage.getItem(renderSetting) !== "false")
+  const [report, setReport] = useState<ImportReport | null>(null)
+
+  const load = useCallback(
+    () =>
+      (search ? api.search(search) : api.documents())
+        .then(setDocuments)
+        .catch((e: Error) => setError(e.message)),
+    [search],
+  )
+  useEffect(() => {
+    load()
+  }, [load])
+
+  const rows = useMemo(() => {
+    const filtered = documents.filter((doc) => matches(doc, filter))
+    if (!sort) {
+      return filtered
+    }
+    const sorted = filtered.sort(compare[sort.key])
+    return sort.descending ? sorted.reverse() : sorted
+  }, [documents, filter, sort])
+
+  // run performs a change and reloads the documents, since edits re-embed
+  // the content and may change what the server returns.
+  const run = async (change: () => Promise<unknown>) => {
+    setError("")
+    try {
+      await change()
+      await load()
+      return true
+    } catch (e) {
+      setError((e as Error).message)
+      return false
+    }
+  }
+
+  const searchByMeaning = (e: FormEvent) => {
+    e.preventDefault()
+    setSearch(filter.trim())
+    setFilter("")
+    setSort(filter.trim() ? null : defaultSort)
+  }
+
+  const clearSearch = () => {
+    setSearch("")
+    setSort(defaultSort)
+  }
+
+  const toggleRender = () => {
+    localStorage.setItem(renderSetting, String(!render))
+    setRender(!render)
+  }
+
+  const toggleFavorite = (doc: Document) => {
+    // Flip the star right away; reloading corrects it if the request fails.
+    setDocuments((docs) => docs.map((d) => (d.id === doc.id ? { ...d, favorite: !doc.favorite } : d)))
+    run(() => api.setFavorite(doc.id, !doc.favorite))
+  }
+
+  const remove = (doc: Document) => {
+    if (confirm("Delete this document?")) {
+      run(() => api.deleteDocument(doc.id))
+    }
+  }
+
+  const SortHeader = ({ column, children, className }: { column: SortKey; children: ReactNode; className?: string }) => {
+    // active is the sort by this column, if it is the current one
+    const active = sort?.key === column ? sort : null
+    const Icon = !active ? ArrowUpDown : active.descending ? ArrowDown : ArrowUp
+    return (
+      <TableHead className={className} aria-sort={active ? (active.descending ? "descending" : "ascending") : "none"}>
+        <Button
+          variant="ghost"
+          size="sm"
+          className="-ml-3"
+          onClick={() => setSort({ key: column, descending: active ? !active.descending : column !== "content" })}
+        >
+          {children}
+          <Icon className={cn(!active && "opacity-40")} />
+        </Button>
+      </TableHead>
+    )
+  }
+
+  return (
+    <div className="flex flex-col gap-6">
+      <h1 className="text-2xl font-semibold">Documents</h1>
+      {error && <p className="text-destructive text-sm">{error}</p>}
+
+      <NewDocument onCreate={(doc) => run(() => api.createDocument(doc))} />
+
+      <Card>
+        <CardHeader className="flex flex-row flex-wrap items-center justify-between gap-4">
+          <CardTitle>
+            {search ? (
+              <>
+                {rows.length} of {documents.length} results for “{search}”
+              </>
+            ) : (
+              <>
+                {rows.length} of {documents.length} documents
+              </>
+            )}
+          </CardTitle>
+          <div className="flex items-center gap-2">
+            <label className="text-muted-foreground flex items-center gap-2 text-sm">
+              <input type="checkbox" checked={render} onChange={toggleRender} />
+              Render markdown
+            </label>
+            <form className="flex items-center gap-2" onSubmit={searchByMeaning}>
+              <Input
+                className="w-72"
+                placeholder="Filter, or press Enter to search by meaning"
+                value={filter}
+                onChange={(e) => setFilter(e.target.value)}
+              />
+              <Button type="submit" variant="outline" size="icon" title="Search by meaning">
+                <Search />
+              </Button>
+            </form>
+            {search && (
+              <Button variant="ghost" size="sm" onClick={clearSearch}>
+                <X />
+                Show all
+              </Button>
+            )}
+          </div>
+        </CardHeader>
+        <CardContent>
+          <Table>
+            <TableHeader>
+              <TableRow>
+                <SortHeader column="favorite" className="w-12">
+                  <Star />
+                </SortHeader>
+                <SortHeader column="content">Content</SortHeader>
+                <SortHeader column="tags" className="w-56">
+                  Tags
+                </SortHeader>
+                <SortHeader column="created_at" className="w-44">
+                  Updated
+                </SortHeader>
+                <TableHead className="w-24" />
+              </TableRow>
+            </TableHeader>
+            <TableBody>
+              {rows.map((doc) =>
+                editing === doc.id ? (
+                  <EditRow
+                    key={doc.id}
+                    doc={doc}
+                    onCancel={() => setEditing(null)}
+                    onSave={async (content, tags) => {
+                      const saved = await run(() =>
+                        api.updateDocument(doc.id, { content, tags, favorite: doc.favorite, properties: doc.properties }),
+                      )
+                      if (saved) setEditing(null)
+                    }}
+                  />
+                ) : (
+                  <TableRow key={doc.id}>
+                    <TableCell>
+                      <Button
+                        variant="ghost"
+                        size="icon"
+                        aria-pressed={doc.favorite}
+                        title={doc.favorite ? "Unmark favorite" : "Mark favorite"}
+                        onClick={() => toggleFavorite(doc)}
+                      >
+                        <Star className={cn(doc.favorite && "fill-yellow-400 text-yellow-500")} />
+                      </Button>
+                    </TableCell>
+                    <TableCell className="whitespace-normal" onDoubleClick={() => setEditing(doc.id)}>
+                      <Markdown content={doc.content} render={render} />
+                      <div className="text-muted-foreground mt-1 flex flex-wrap gap-x-3 text-xs">
+                        <span className="font-mono">{doc.id}</span>
+                        {formatProvenance(doc.provenance) && <span>{formatProvenance(doc.provenance)}</span>}
+                        {doc.score !== undefined && <span>score {doc.score.toFixed(3)}</span>}
+                      </div>
+                    </TableCell>
+                    <TableCell>
+                      <div className="flex flex-wrap gap-1">
+                        {doc.tags.map((tag) => (
+                          <Badge key={tag} variant="secondary">
+                            {tag}
+                          </Badge>
+                        ))}
+                      </div>
+                    </TableCell>
+                    <TableCell className="text-muted-foreground text-xs">
+                      {new Date(doc.created_at).toLocaleString()}
+                    </TableCell>
+                    <TableCell>
+                      <div className="flex">
+                        <Button variant="ghost" size="icon" title="Edit" onClick={() => setEditing(doc.id)}>
+                          <Pencil />
+                        </Button>
+                        <Button variant="ghost" size="icon" title="Delete" onClick={() => remove(doc)}>
+                          <Trash2 />
+                        </Button>
+                      </div>
+                    </TableCell>
+                  </TableRow>
+                ),
+              )}
+              {rows.length === 0 && (
+                <TableRow>
+                  <TableCell colSpan={5} className="text-muted-foreground py-8 text-center">
+                    {documents.length > 0
+                      ? "No documents match the filter."
+                      : search
+                        ? "No documents match the search."
+                        : "No documents yet."}
+                  </TableCell>
+                </TableRow>
+              )}
+            </TableBody>
+          </Table>
+        </CardContent>
+      </Card>
+
+      <Transfer
+        report={report}
+        onImport={(file, format) => run(() => api.importDocuments(file, format).then(setReport))}
+      />
+    </div>
+  )
+}
+
+// EditRow edits a document in place. Saving replaces its content and tags,
+// which the server re-embeds.
+function EditRow({
+  doc,
+  onSave,
+  onCancel,
+}: {
+  doc: Document
+  onSave: (content: string, tags: string[]) => void
+  onCancel: () => void
+}) {
+  const [content, setContent] = useState(doc.content)
+  const [tags, setTags] = useState(doc.tags.join(", "))
+
+  return (
+    <TableRow
+      className="bg-muted/30"
+      onKeyDown={(e) => {
+        if (e.key === "Escape") onCancel()
+        if (e.key === "Enter" && (e.metaKey || e.ctrlKey)) onSave(content, parseTags(tags))
+      }}
+    >
+      <TableCell />
+      <TableCell>
+        <Textarea autoFocus value={content} onChange={(e) => setContent(e.target.value)} />
+      </TableCell>
+      <TableCell>
+        <Input value={tags} placeholder="tag1, tag2" onChange={(e) => setTags(e.target.value)} />
+      </TableCell>
+      <TableCell />
+      <TableCell>
+        <div className="flex">
+          <Button variant="ghost" size="icon" title="Save (Ctrl+Enter)" onClick={() => onSave(content, parseTags(tags))}>
+            <Check />
+          </Button>
+          <Button variant="ghost" size="icon" title="Cancel (Esc)" onClick={onCancel}>
+            <X />
+          </Button>
+        </div>
+      </TableCell>
+    </TableRow>
+  )
+}
+
+function NewDocument({
+  onCreate,
+}: {
+  onCreate: (doc: { content: string; tags: string[]; favorite: boolean; properties: null }) => Promise<boolean>
+}) {
+  const [content, setContent] = useState("")
+  const [tags, setTags] = useState("")
+  const [favorite, setFavorite] = useState(false)
+
+  const submit = async (e: FormEvent) => {
+    e.preventDefault()
+    if (await onCreate({ content, tags: parseTags(tags), favorite, properties: null })) {
+      setContent("")
+      setTags("")
+      setFavorite(false)
+    }
+  }
+
+  return (
+    <Card>
+      <CardHeader>
+        <CardTitle>New document</CardTitle>
+      </CardHeader>
+      <CardContent>
+        <form className="flex flex-col gap-3" onSubmit={submit}>
+          <Textarea required placeholder="Content" value={content} onChange={(e) => setContent(e.target.value)} />
+          <div className="flex items-center gap-3">
+            <Input placeholder="Tags, comma-separated" value={tags} onChange={(e) => setTags(e.target.value)} />
+            <Button
+              type="button"
+              variant="outline"
+              aria-pressed={favorite}
+              onClick={() => setFavorite(!favorite)}
+            >
+              <Star className={cn(favorite && "fill-yellow-400 text-yellow-500")} />
+              Favorite
+            </Button>
+            <Button type="submit">
+              <Plus />
+              Add
+            </Button>
+          </div>
+        </form>
+      </CardContent>
+    </Card>
+  )
+}
+
+// Transfer offers the exports and imports files in the same formats. Rows
+// that could not be imported are listed in the report.
+function Transfer({
+  onImport,
+  report,
+}: {
+  onImport: (file: File, format: ExportFormat) => Promise<boolean>
+  report: ImportReport | null
+}) {
+  const [error, setError] = useState("")
+
+  const upload = (input: HTMLInputElement) => {
+    const file = input.files?.[0]
+    input.value = ""
+    if (!file) return
+    const format = importFormat(file.name)
+    if (!format) {
+      setError("Choose a .json, .jsonl or .csv file")
+      return
+    }
+    setError("")
+    onImport(file, format)
+  }
+
+  return (
+    <Card>
+      <CardHeader>
+        <CardTitle>Import and export</CardTitle>
+        <CardDescription>
+          Exports contain every document, oldest first. Imports keep IDs, creation times and provenance; documents
+          whose ID is taken are reported rather than replaced.
+        </CardDescription>
+      </CardHeader>
+      <CardContent className="flex flex-col gap-3">
+        <div className="flex flex-wrap items-center gap-2">
+          {(["json", "jsonl", "csv"] as ExportFormat[]).map((format) => (
+            <Button key={format} variant="outline" size="sm" asChild>
+              <a href={exportURL(format)} download>
+                <Download />
+                Export {format.toUpperCase()}
+              </a>
+            </Button>
+          ))}
+          <Button variant="outline" size="sm" asChild>
+            <label className="cursor-pointer">
+              <Upload />
+              Import a file
+              <input
+                type="file"
+                accept=".json,.jsonl,.ndjson,.csv"
+                className="hidden"
+                onChange={(e) => upload(e.target)}
+              />
+            </label>
+          </Button>
+        </div>
+        {error && <p className="text-destructive text-sm">{error}</p>}
+        {report && (
+          <div className="text-sm">
+            <p>
+              Imported {report.imported} documents ({report.replaced} replaced)
+              {report.errors?.length ? `, ${report.errors.length} rows failed:` : "."}
+            </p>
+            {report.errors && (
+              <ul className="text-muted-foreground list-disc pl-5 text-xs">
+                {report.errors.map((e) => (
+                  <li key={e.row}>
+                    Row {e.row}
+                    {e.id && ` (${e.id})`}: {e.message}
+                  </li>
+                ))}
+              </ul>
+            )}
+          </div>
+        )}
+      </CardContent>
+    </Card>
+  )
+}
@@ -0,0 +1,32 @@
+import path from "node:path"
+import tailwindcss from "@tailwindcss/vite"
+import react from "@vitejs/plugin-react"
+import { defineConfig } from "vite"
+
+// The Go server serves the built app and the REST API on one origin. During
+// development, run the server on :8080 and "npm run dev"; everything that is
+// not part of the app is proxied to it.
+const server = "http://localhost:8080"
+
+export default defineConfig({
+  plugins: [react(), tailwindcss()],
+  resolve: {
+    alias: {
+      "@": path.resolve(__dirname, "./src"),
+    },
+  },
+  build: {
+    outDir: "dist",
+    emptyOutDir: true,
+  },
+  server: {
+    proxy: {
+      "/api": server,
+      "/metrics": server,
+      "/login": server,
+      "/logout": server,
+      "/databases": server,
+      "/classic": server,
+    },
+  },
+})